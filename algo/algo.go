@@ -0,0 +1,314 @@
+// Package algo works large orders over time by slicing them into child limit
+// orders, on a schedule (TWAP) or after traded volume (VWAP).
+package algo
+
+import (
+	"errors"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/jflyup/goup"
+	"github.com/jflyup/goup/poller"
+	"github.com/jflyup/goup/util"
+)
+
+var (
+	ErrInvalidParent  = errors.New("invalid parent order")
+	ErrInvalidProfile = errors.New("invalid volume profile")
+	ErrNoQuote        = errors.New("no quote to price the child order")
+)
+
+// pollInterval is how often trades are polled when the exchange has no
+// trade stream
+var pollInterval = 5 * time.Second
+
+// Parent is an order worked by an algo
+type Parent struct {
+	Pair goup.CurrencyPair
+	Side goup.TradeSide
+	// Amount is in base currency
+	Amount float64
+	// Limit is the worst price of child orders, 0 for none. Children take
+	// the best opposite quote, or rest at Limit when that's worse.
+	Limit float64
+	// Duration is split into Slices, a child order rests for one slice
+	Duration time.Duration
+	Slices   int
+	// MaxParticipation caps a child at this fraction of the volume traded
+	// during the previous slice, 0 for none. The first slice only observes
+	// then.
+	MaxParticipation float64
+}
+
+// Progress is reported after every slice
+type Progress struct {
+	Slice,
+	Slices int
+	// Child is the final state of the child order of the slice, nil if none
+	// was placed
+	Child *goup.Order
+	Filled,
+	Remaining float64
+	// AvgPrice is the average price of the fills so far
+	AvgPrice float64
+	Err      error
+}
+
+// Algo works a parent order, create it with TWAP or VWAP
+type Algo struct {
+	api    goup.API
+	parent Parent
+	// weights is the share of the parent per slice, nil to follow the
+	// observed volume
+	weights []float64
+	poller  *poller.Poller
+	stop    chan struct{}
+	once    sync.Once
+	lock    sync.Mutex
+	// volume is what was traded since the current slice started, trades
+	// are ignored once done since streams can't be unsubscribed
+	volume float64
+	done   bool
+	filled,
+	cost float64
+}
+
+// TWAP works parent in equal slices over its duration, what a slice didn't
+// fill is added to the next one.
+func TWAP(api goup.API, parent Parent) (*Algo, error) {
+	if parent.Slices <= 0 {
+		return nil, ErrInvalidParent
+	}
+
+	weights := make([]float64, parent.Slices)
+	for i := range weights {
+		weights[i] = 1 / float64(parent.Slices)
+	}
+
+	return newAlgo(api, parent, weights)
+}
+
+// VWAP works parent in proportion to volume. With a profile, e.g. from
+// KlineProfile, slice i takes its share profile[i] of the total. With a nil
+// profile a slice takes MaxParticipation of the volume traded during the
+// previous one, what's left after the last slice stays unfilled.
+func VWAP(api goup.API, parent Parent, profile []float64) (*Algo, error) {
+	if profile == nil {
+		if parent.MaxParticipation <= 0 {
+			return nil, ErrInvalidParent
+		}
+		return newAlgo(api, parent, nil)
+	}
+
+	if len(profile) != parent.Slices {
+		return nil, ErrInvalidProfile
+	}
+
+	var total float64
+	for _, v := range profile {
+		if v < 0 {
+			return nil, ErrInvalidProfile
+		}
+		total += v
+	}
+	if total == 0 {
+		return nil, ErrInvalidProfile
+	}
+
+	weights := make([]float64, len(profile))
+	for i, v := range profile {
+		weights[i] = v / total
+	}
+
+	return newAlgo(api, parent, weights)
+}
+
+func newAlgo(api goup.API, parent Parent, weights []float64) (*Algo, error) {
+	if parent.Amount <= 0 || parent.Slices <= 0 || parent.Duration <= 0 || parent.Limit < 0 ||
+		parent.MaxParticipation < 0 || parent.MaxParticipation > 1 {
+		return nil, ErrInvalidParent
+	}
+
+	return &Algo{
+		api:     api,
+		parent:  parent,
+		weights: weights,
+		poller:  poller.New(pollInterval),
+		stop:    make(chan struct{}),
+	}, nil
+}
+
+// Run works the order until it's filled, the slices are over or Stop is
+// called. handler gets the progress of every slice and may be nil, the last
+// progress is returned. A child order whose final state can't be read ends
+// the run, since what's filled is unknown then.
+func (a *Algo) Run(handler func(*Progress)) *Progress {
+	defer a.poller.Close()
+	defer func() {
+		a.lock.Lock()
+		a.done = true
+		a.lock.Unlock()
+	}()
+
+	if a.weights == nil || a.parent.MaxParticipation > 0 {
+		a.watch()
+	}
+
+	interval := a.parent.Duration / time.Duration(a.parent.Slices)
+	p := &Progress{Slices: a.parent.Slices, Remaining: a.parent.Amount}
+	for i := 0; i < a.parent.Slices && p.Remaining > 0; i++ {
+		observed := a.takeVolume()
+		if i == 0 {
+			observed = 0
+		}
+
+		var stopped bool
+		p, stopped = a.slice(i, observed, interval)
+		if handler != nil {
+			handler(p)
+		}
+
+		if stopped || p.Child != nil && !p.Child.Status.Done() {
+			break
+		}
+	}
+
+	return p
+}
+
+// Stop ends Run early, the resting child order is canceled
+func (a *Algo) Stop() {
+	a.once.Do(func() {
+		close(a.stop)
+	})
+}
+
+// slice places and cancels the child of slice i, it reports whether the
+// algo was stopped meanwhile
+func (a *Algo) slice(i int, observed float64, interval time.Duration) (*Progress, bool) {
+	p := &Progress{Slice: i, Slices: a.parent.Slices}
+	var child *goup.Order
+	if want := a.target(i, observed); want > 0 {
+		child, p.Err = a.place(want)
+	}
+
+	stopped := a.wait(interval)
+	if child != nil {
+		p.Child, p.Err = util.CancelRemainder(a.api, child, a.parent.Pair)
+		if p.Child.Status.Done() {
+			// fills may be better than the limit, which is the fallback
+			// of exchanges not reporting the average
+			price := p.Child.AvgPrice
+			if price == 0 {
+				price = child.Price
+			}
+			a.filled += p.Child.DealAmount
+			a.cost += p.Child.DealAmount * price
+		}
+	}
+
+	if p.Err != nil {
+		log.Printf("ERROR\tslice %d of %s %s: %v", i, a.parent.Side, a.parent.Pair, p.Err)
+	}
+
+	p.Filled = a.filled
+	p.Remaining = math.Max(a.parent.Amount-a.filled, 0)
+	if a.filled > 0 {
+		p.AvgPrice = a.cost / a.filled
+	}
+	return p, stopped
+}
+
+// target returns the amount of the child of slice i, observed is the volume
+// traded during the previous slice
+func (a *Algo) target(i int, observed float64) float64 {
+	remaining := a.parent.Amount - a.filled
+	var want float64
+	if a.weights == nil {
+		want = a.parent.MaxParticipation * observed
+	} else {
+		var share float64
+		for _, w := range a.weights[:i+1] {
+			share += w
+		}
+		want = a.parent.Amount*share - a.filled
+
+		if a.parent.MaxParticipation > 0 {
+			want = math.Min(want, a.parent.MaxParticipation*observed)
+		}
+	}
+
+	return math.Min(want, remaining)
+}
+
+// place prices a child at the best opposite quote within the limit
+func (a *Algo) place(amount float64) (*goup.Order, error) {
+	ticker, err := a.api.GetTicker(a.parent.Pair)
+	if err != nil {
+		return nil, err
+	}
+
+	buy := a.parent.Side == goup.Buy
+	price := ticker.Buy
+	if buy {
+		price = ticker.Sell
+	}
+
+	if limit := a.parent.Limit; limit > 0 && (price <= 0 || buy && price > limit || !buy && price < limit) {
+		price = limit
+	}
+	if price <= 0 {
+		return nil, ErrNoQuote
+	}
+
+	if buy {
+		return a.api.LimitBuy(amount, price, a.parent.Pair)
+	}
+	return a.api.LimitSell(amount, price, a.parent.Pair)
+}
+
+// wait sleeps for d, it reports whether the algo was stopped meanwhile
+func (a *Algo) wait(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return false
+	case <-a.stop:
+		return true
+	}
+}
+
+// watch sums up the traded volume, from WsTrades or by polling trades
+func (a *Algo) watch() {
+	if err := a.api.WsTrades(a.parent.Pair, a.addVolume); err != nil {
+		log.Printf("ERROR\tno trade stream of %s, polling trades: %v", a.parent.Pair, err)
+		a.poller.Trades(a.api, a.parent.Pair, a.addVolume)
+	}
+}
+
+func (a *Algo) addVolume(trades []*goup.Trade) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.done {
+		return
+	}
+
+	for _, t := range trades {
+		a.volume += t.Amount
+	}
+}
+
+// takeVolume returns the volume traded since the last call
+func (a *Algo) takeVolume() float64 {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	v := a.volume
+	a.volume = 0
+	return v
+}
@@ -0,0 +1,255 @@
+package algo
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jflyup/goup"
+)
+
+// fakeExchange fills every child order up to fill of its amount at once
+type fakeExchange struct {
+	goup.API
+	lock     sync.Mutex
+	ticker   goup.Ticker
+	fill     float64
+	children []goup.Order
+	handler  func([]*goup.Trade)
+	klines   []*goup.Kline
+	// avg is the average price of fills, 0 if not reported
+	avg float64
+	// klineLimit caps the klines of a call like exchanges do, 0 for none
+	klineLimit,
+	klineCalls int
+}
+
+func (f *fakeExchange) GetTicker(pair goup.CurrencyPair) (*goup.Ticker, error) {
+	t := f.ticker
+	return &t, nil
+}
+
+func (f *fakeExchange) place(side goup.TradeSide, amount, price float64) (*goup.Order, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	o := goup.Order{OrderID: string(rune('a' + len(f.children))), Side: side, Price: price, Amount: amount}
+	f.children = append(f.children, o)
+	return &o, nil
+}
+
+func (f *fakeExchange) LimitBuy(amount, price float64, pair goup.CurrencyPair) (*goup.Order, error) {
+	return f.place(goup.Buy, amount, price)
+}
+
+func (f *fakeExchange) LimitSell(amount, price float64, pair goup.CurrencyPair) (*goup.Order, error) {
+	return f.place(goup.Sell, amount, price)
+}
+
+func (f *fakeExchange) GetOrder(orderID string, pair goup.CurrencyPair) (*goup.Order, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	o := f.children[orderID[0]-'a']
+	o.DealAmount = o.Amount * f.fill
+	o.AvgPrice = f.avg
+	o.Status = goup.Canceled
+	if f.fill == 1 {
+		o.Status = goup.Filled
+	}
+	return &o, nil
+}
+
+func (f *fakeExchange) CancelOrder(orderID string, pair goup.CurrencyPair) (bool, error) {
+	return true, nil
+}
+
+func (f *fakeExchange) WsTrades(pair goup.CurrencyPair, handler func([]*goup.Trade), opts ...goup.SubOption) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.handler = handler
+	return nil
+}
+
+func (f *fakeExchange) GetKlines(pair goup.CurrencyPair, interval goup.KlineInterval, size, since int) ([]*goup.Kline, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.klineCalls++
+	var klines []*goup.Kline
+	for _, k := range f.klines {
+		if k.OpenTime >= int64(since) {
+			klines = append(klines, k)
+		}
+	}
+
+	if f.klineLimit > 0 && len(klines) > f.klineLimit {
+		klines = klines[:f.klineLimit]
+	}
+	return klines, nil
+}
+
+func (f *fakeExchange) amounts() []float64 {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	var amounts []float64
+	for _, c := range f.children {
+		amounts = append(amounts, c.Amount)
+	}
+	return amounts
+}
+
+func equal(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestTWAP(t *testing.T) {
+	tables := []struct {
+		fill    float64
+		limit   float64
+		price   float64
+		amounts []float64
+	}{
+		{1, 0, 101, []float64{2, 2, 2, 2}},
+		// what a slice misses is added to the next
+		{0.5, 0, 101, []float64{2, 3, 3.5, 3.75}},
+		// the ask is above the limit, children rest at it
+		{1, 100, 100, []float64{2, 2, 2, 2}},
+	}
+
+	for _, table := range tables {
+		f := &fakeExchange{ticker: goup.Ticker{Buy: 99, Sell: 101}, fill: table.fill}
+		a, err := TWAP(f, Parent{Side: goup.Buy, Amount: 8, Limit: table.limit, Duration: 4 * time.Millisecond, Slices: 4})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var reports int
+		p := a.Run(func(*Progress) { reports++ })
+		if amounts := f.amounts(); !equal(amounts, table.amounts) || reports != 4 {
+			t.Errorf("fill %v: children %v, %d reports", table.fill, amounts, reports)
+		}
+
+		var filled float64
+		for _, v := range table.amounts {
+			filled += v * table.fill
+		}
+		if p.Filled != filled || p.Remaining != 8-filled || p.AvgPrice != table.price || f.children[0].Price != table.price {
+			t.Errorf("fill %v: got %+v", table.fill, p)
+		}
+	}
+
+	if _, err := TWAP(&fakeExchange{}, Parent{Amount: 1, Slices: 1}); err != ErrInvalidParent {
+		t.Errorf("got %v, want ErrInvalidParent without duration", err)
+	}
+}
+
+// TestFillPrice checks that fills count at their average price, and that
+// trades are ignored once the run is over
+func TestFillPrice(t *testing.T) {
+	f := &fakeExchange{ticker: goup.Ticker{Buy: 99, Sell: 101}, fill: 1, avg: 100.5}
+	a, err := TWAP(f, Parent{Side: goup.Buy, Amount: 4, Duration: 2 * time.Millisecond, Slices: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p := a.Run(nil); p.Filled != 4 || p.AvgPrice != 100.5 {
+		t.Errorf("got %+v, want 4 filled at 100.5", p)
+	}
+
+	a.addVolume([]*goup.Trade{{Amount: 10}})
+	if v := a.takeVolume(); v != 0 {
+		t.Errorf("volume %v added after Run", v)
+	}
+}
+
+func TestVWAP(t *testing.T) {
+	f := &fakeExchange{ticker: goup.Ticker{Buy: 99, Sell: 101}, fill: 1}
+	a, err := VWAP(f, Parent{Side: goup.Sell, Amount: 10, Duration: 3 * time.Millisecond, Slices: 3}, []float64{1, 3, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := a.Run(nil)
+	if amounts := f.amounts(); !equal(amounts, []float64{2, 6, 2}) || p.Filled != 10 || p.AvgPrice != 99 {
+		t.Errorf("children %v, got %+v", amounts, p)
+	}
+}
+
+func TestVWAPParticipation(t *testing.T) {
+	f := &fakeExchange{ticker: goup.Ticker{Buy: 99, Sell: 101}, fill: 1}
+	a, err := VWAP(f, Parent{Side: goup.Buy, Amount: 10, Duration: 600 * time.Millisecond, Slices: 3, MaxParticipation: 0.1}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	progress := make(chan *Progress, 3)
+	go a.Run(func(p *Progress) { progress <- p })
+
+	// 50 trade during the first slice, which only observes
+	for {
+		f.lock.Lock()
+		handler := f.handler
+		f.lock.Unlock()
+		if handler != nil {
+			handler([]*goup.Trade{{Amount: 20}, {Amount: 30}})
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if p := <-progress; p.Child != nil {
+		t.Errorf("first slice placed %+v", p.Child)
+	}
+	if p := <-progress; p.Child == nil || p.Child.Amount != 5 {
+		t.Errorf("second slice: got %+v, want 10%% of 50", p)
+	}
+
+	// nothing traded during the second slice
+	a.Stop()
+	if p := <-progress; p.Child != nil || p.Filled != 5 {
+		t.Errorf("third slice: got %+v", p)
+	}
+}
+
+func TestKlineProfile(t *testing.T) {
+	step := int64(5 * 60000)
+	start := (time.Now().UnixNano()/int64(time.Millisecond) - dayMs) / step * step
+	f := &fakeExchange{klines: []*goup.Kline{
+		{OpenTime: start - step, Vol: 100},
+		{OpenTime: start, Vol: 1},
+		{OpenTime: start + step, Vol: 2},
+		{OpenTime: start + 2*step, Vol: 3},
+		{OpenTime: start + 3*step, Vol: 100},
+	}}
+
+	profile, err := KlineProfile(f, goup.CurrencyPair{}, goup.KlineInterval5Min, 3)
+	if err != nil || !equal(profile, []float64{1, 2, 3}) {
+		t.Errorf("got %v, %v", profile, err)
+	}
+}
+
+// TestKlineProfilePaged reads a window longer than the exchange returns at once
+func TestKlineProfilePaged(t *testing.T) {
+	step := int64(60000)
+	start := (time.Now().UnixNano()/int64(time.Millisecond) - dayMs) / step * step
+	f := &fakeExchange{klineLimit: 2, klines: []*goup.Kline{{OpenTime: start - step, Vol: 100}}}
+	for i := int64(0); i < 6; i++ {
+		f.klines = append(f.klines, &goup.Kline{OpenTime: start + i*step, Vol: float64(i + 1)})
+	}
+
+	profile, err := KlineProfile(f, goup.CurrencyPair{}, goup.KlineInterval1Min, 5)
+	if err != nil || !equal(profile, []float64{1, 2, 3, 4, 5}) || f.klineCalls != 3 {
+		t.Errorf("got %v, %v in %d calls", profile, err, f.klineCalls)
+	}
+}
@@ -0,0 +1,57 @@
+package algo
+
+import (
+	"github.com/jflyup/goup"
+	"github.com/jflyup/goup/poller"
+	"github.com/jflyup/goup/util"
+)
+
+const dayMs = 24 * 3600 * 1000
+
+// KlineProfile returns the volume of the next slices klines of interval as
+// traded at the same time a day earlier, a profile for VWAP. The slices of
+// the parent order should last interval. Klines are read from the start of
+// that window on, page by page since exchanges cap the klines of a call.
+func KlineProfile(api poller.KlinesGetter, pair goup.CurrencyPair, interval goup.KlineInterval, slices int) ([]float64, error) {
+	if interval <= 0 || slices <= 0 {
+		return nil, ErrInvalidProfile
+	}
+
+	step := int64(interval) * 60000
+	start := (util.NowMs() - dayMs) / step * step
+	end := start + int64(slices)*step
+	profile := make([]float64, slices)
+	var total float64
+	for since := start; since < end; {
+		klines, err := api.GetKlines(pair, interval, int((end-since)/step), int(since))
+		if err != nil {
+			return nil, err
+		}
+
+		next := since
+		for _, k := range klines {
+			// pages may overlap
+			if k.OpenTime < since || k.OpenTime >= end {
+				continue
+			}
+
+			profile[(k.OpenTime-start)/step] += k.Vol
+			total += k.Vol
+			if k.OpenTime+step > next {
+				next = k.OpenTime + step
+			}
+		}
+
+		// nothing more was traded, or the exchange has no older klines
+		if next == since {
+			break
+		}
+		since = next
+	}
+
+	if total == 0 {
+		return nil, ErrInvalidProfile
+	}
+
+	return profile, nil
+}
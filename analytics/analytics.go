@@ -0,0 +1,176 @@
+// Package analytics estimates execution costs and summarizes liquidity of
+// order books. Depth records are expected best first, i.e. asks ascending
+// and bids descending.
+package analytics
+
+import (
+	"math"
+
+	"github.com/jflyup/goup"
+)
+
+// Unit tells in which currency an amount is given
+type Unit int
+
+const (
+	// Base amounts are in the base currency, e.g. ETH of ETH/BTC
+	Base Unit = iota
+	// Quote amounts are in the quote currency, e.g. BTC of ETH/BTC
+	Quote
+)
+
+// Execution is the estimated outcome of a market order walking the book
+type Execution struct {
+	AvgPrice   float64
+	BestPrice  float64
+	WorstPrice float64
+	// SlippageBps is the distance of AvgPrice from BestPrice in basis points,
+	// always positive
+	SlippageBps float64
+	// Filled is in base currency and Cost in quote currency
+	Filled,
+	Cost float64
+	// Unfilled is what the book can't absorb, in the unit of the order
+	Unfilled float64
+}
+
+// Complete reports whether the whole amount could be filled
+func (e *Execution) Complete() bool {
+	return e.Unfilled == 0
+}
+
+// EstimateBuy walks asks to buy amount given in unit
+func EstimateBuy(asks goup.DepthRecords, amount float64, unit Unit) *Execution {
+	return estimate(asks, amount, unit)
+}
+
+// EstimateSell walks bids to sell amount given in unit
+func EstimateSell(bids goup.DepthRecords, amount float64, unit Unit) *Execution {
+	return estimate(bids, amount, unit)
+}
+
+func estimate(levels goup.DepthRecords, amount float64, unit Unit) *Execution {
+	e := &Execution{Unfilled: amount}
+	for _, level := range levels {
+		if e.Unfilled <= 0 {
+			break
+		}
+
+		if level.Amount <= 0 || level.Price <= 0 {
+			continue
+		}
+
+		if e.BestPrice == 0 {
+			e.BestPrice = level.Price
+		}
+
+		// how much of this level is taken, in base
+		take := level.Amount
+		if unit == Quote {
+			take = math.Min(take, e.Unfilled/level.Price)
+			e.Unfilled -= take * level.Price
+		} else {
+			take = math.Min(take, e.Unfilled)
+			e.Unfilled -= take
+		}
+
+		e.Filled += take
+		e.Cost += take * level.Price
+		e.WorstPrice = level.Price
+	}
+
+	// don't report float residues as unfilled
+	if e.Unfilled < amount*1e-12 {
+		e.Unfilled = 0
+	}
+
+	if e.Filled > 0 {
+		e.AvgPrice = e.Cost / e.Filled
+		e.SlippageBps = math.Abs(e.AvgPrice-e.BestPrice) / e.BestPrice * 1e4
+	}
+
+	return e
+}
+
+// Mid returns the mean of best ask and best bid, 0 if either side is empty
+func Mid(depth *goup.Depth) float64 {
+	if len(depth.AskList) == 0 || len(depth.BidList) == 0 {
+		return 0
+	}
+
+	return (depth.AskList[0].Price + depth.BidList[0].Price) / 2
+}
+
+// Microprice is the mid weighted by the opposite sizes at the top of book,
+// it leans towards the side about to be depleted. 0 if either side is empty.
+func Microprice(depth *goup.Depth) float64 {
+	if len(depth.AskList) == 0 || len(depth.BidList) == 0 {
+		return 0
+	}
+
+	ask, bid := depth.AskList[0], depth.BidList[0]
+	if ask.Amount+bid.Amount == 0 {
+		return Mid(depth)
+	}
+
+	return (bid.Price*ask.Amount + ask.Price*bid.Amount) / (ask.Amount + bid.Amount)
+}
+
+// Imbalance returns (bids - asks) / (bids + asks) of the amounts in the best
+// n levels, in [-1, 1], positive when buyers dominate. n <= 0 means all levels.
+func Imbalance(depth *goup.Depth, n int) float64 {
+	bids := sum(depth.BidList, n)
+	asks := sum(depth.AskList, n)
+	if bids+asks == 0 {
+		return 0
+	}
+
+	return (bids - asks) / (bids + asks)
+}
+
+// Liquidity is the amount resting on each side of a book
+type Liquidity struct {
+	// in base currency
+	Bids, Asks float64
+	// in quote currency
+	BidsQuote, AsksQuote float64
+}
+
+// LiquidityWithin sums the levels priced within bps basis points of mid
+func LiquidityWithin(depth *goup.Depth, bps float64) *Liquidity {
+	l := &Liquidity{}
+	mid := Mid(depth)
+	if mid == 0 {
+		return l
+	}
+
+	for _, ask := range depth.AskList {
+		if ask.Price > mid*(1+bps/1e4) {
+			break
+		}
+		l.Asks += ask.Amount
+		l.AsksQuote += ask.Amount * ask.Price
+	}
+
+	for _, bid := range depth.BidList {
+		if bid.Price < mid*(1-bps/1e4) {
+			break
+		}
+		l.Bids += bid.Amount
+		l.BidsQuote += bid.Amount * bid.Price
+	}
+
+	return l
+}
+
+func sum(levels goup.DepthRecords, n int) float64 {
+	if n <= 0 || n > len(levels) {
+		n = len(levels)
+	}
+
+	total := 0.0
+	for _, level := range levels[:n] {
+		total += level.Amount
+	}
+	return total
+}
@@ -0,0 +1,77 @@
+package analytics
+
+import (
+	"math"
+	"testing"
+
+	"github.com/jflyup/goup"
+)
+
+var depth = &goup.Depth{
+	AskList: goup.DepthRecords{{Price: 101, Amount: 1}, {Price: 102, Amount: 2}, {Price: 110, Amount: 5}},
+	BidList: goup.DepthRecords{{Price: 99, Amount: 3}, {Price: 98, Amount: 1}, {Price: 90, Amount: 10}},
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestEstimate(t *testing.T) {
+	tables := []struct {
+		buy    bool
+		amount float64
+		unit   Unit
+		want   Execution
+	}{
+		{true, 2, Base, Execution{AvgPrice: 101.5, BestPrice: 101, WorstPrice: 102, SlippageBps: 0.5 / 101 * 1e4, Filled: 2, Cost: 203}},
+		{true, 305, Quote, Execution{AvgPrice: 305.0 / 3, BestPrice: 101, WorstPrice: 102, SlippageBps: (305.0/3 - 101) / 101 * 1e4, Filled: 3, Cost: 305}},
+		{true, 10, Base, Execution{AvgPrice: 855.0 / 8, BestPrice: 101, WorstPrice: 110, SlippageBps: (855.0/8 - 101) / 101 * 1e4, Filled: 8, Cost: 855, Unfilled: 2}},
+		{false, 4, Base, Execution{AvgPrice: 98.75, BestPrice: 99, WorstPrice: 98, SlippageBps: 0.25 / 99 * 1e4, Filled: 4, Cost: 395}},
+	}
+
+	for _, table := range tables {
+		var got *Execution
+		if table.buy {
+			got = EstimateBuy(depth.AskList, table.amount, table.unit)
+		} else {
+			got = EstimateSell(depth.BidList, table.amount, table.unit)
+		}
+
+		w := table.want
+		if !near(got.AvgPrice, w.AvgPrice) || got.BestPrice != w.BestPrice || got.WorstPrice != w.WorstPrice ||
+			!near(got.SlippageBps, w.SlippageBps) || !near(got.Filled, w.Filled) || !near(got.Cost, w.Cost) ||
+			!near(got.Unfilled, w.Unfilled) {
+			t.Errorf("estimate(buy: %v, %f, %d) = %+v, want %+v", table.buy, table.amount, table.unit, *got, w)
+		}
+	}
+
+	// an empty book fills nothing instead of dividing by zero
+	e := EstimateBuy(nil, 1, Base)
+	if e.AvgPrice != 0 || e.Unfilled != 1 || e.Complete() {
+		t.Errorf("empty book: %+v", e)
+	}
+}
+
+func TestBookStats(t *testing.T) {
+	if Mid(depth) != 100 {
+		t.Errorf("mid: %f", Mid(depth))
+	}
+
+	// 3 bids against 1 ask at the top, the price leans to the ask
+	if mp := Microprice(depth); !near(mp, (99*1+101*3)/4.0) {
+		t.Errorf("microprice: %f", mp)
+	}
+
+	if im := Imbalance(depth, 1); !near(im, 0.5) {
+		t.Errorf("imbalance: %f", im)
+	}
+
+	l := LiquidityWithin(depth, 200)
+	if l.Asks != 3 || l.Bids != 4 || l.AsksQuote != 305 || l.BidsQuote != 395 {
+		t.Errorf("liquidity: %+v", l)
+	}
+
+	if l := LiquidityWithin(&goup.Depth{}, 200); l.Asks != 0 || l.Bids != 0 {
+		t.Errorf("liquidity of empty book: %+v", l)
+	}
+}
@@ -8,15 +8,33 @@ var (
 	ErrInsufficientBalance = errors.New("insufficient balance")
 	ErrInvalidSymbol       = errors.New("invalid symbol")
 	ErrLowAmount           = errors.New("amount too low")
+	ErrChecksum            = errors.New("checksum mismatch")
+	ErrCancelPending       = errors.New("cancel not confirmed")
+	ErrNoLiquidity         = errors.New("no liquidity within slippage")
+	ErrUnsupported         = errors.New("unsupported")
 )
 
 // API offers an universal API for exchanges
 type API interface {
 	LimitBuy(amount, price float64, pair CurrencyPair) (*Order, error)
 	LimitSell(amount, price float64, pair CurrencyPair) (*Order, error)
+	// MarketBuy spends amount of quote currency, price caps the price if
+	// positive. Exchanges without market orders emulate it with a limit
+	// order whose remainder is canceled.
 	MarketBuy(amount, price float64, pair CurrencyPair) (*Order, error)
+	// MarketSell sells amount of base currency, price is the floor if positive
 	MarketSell(amount, price float64, pair CurrencyPair) (*Order, error)
 	CancelOrder(orderID string, pair CurrencyPair) (bool, error)
+	// PlaceOrders places limit orders in a batch, results are in the order of
+	// reqs. The error is set when the whole batch failed.
+	PlaceOrders(reqs []*OrderRequest) ([]*OrderResult, error)
+	// CancelOrders cancels orders of pair in a batch
+	CancelOrders(pair CurrencyPair, orderIDs []string) ([]*CancelResult, error)
+	// CancelAll cancels all open orders of pair
+	CancelAll(pair CurrencyPair) ([]*CancelResult, error)
+	// ReplaceOrder moves an order to price and amount, amount is the total
+	// size including what the order filled already
+	ReplaceOrder(orderID string, pair CurrencyPair, price, amount float64) (*Replacement, error)
 	// GetOrder get detail of single order
 	GetOrder(orderID string, pair CurrencyPair) (*Order, error)
 	OpenOrders(pair CurrencyPair) ([]*Order, error)
@@ -30,10 +48,17 @@ type API interface {
 	GetTrades(pair CurrencyPair, since int64) ([]*Trade, error)
 
 	// WsDepth gets latest order book of specified symbol via websocket
-	WsDepth(pair CurrencyPair, handler func(*Depth)) error
+	WsDepth(pair CurrencyPair, handler func(*Depth), opts ...SubOption) error
 	// WsTrades gets updates of trade info via websocket
-	WsTrades(pair CurrencyPair, handler func([]*Trade)) error
+	WsTrades(pair CurrencyPair, handler func([]*Trade), opts ...SubOption) error
 	// WsKlines gets updates of kline via websocket
-	WsKlines(pair CurrencyPair, interval KlineInterval, handler func(*Kline)) error
+	WsKlines(pair CurrencyPair, interval KlineInterval, handler func(*Kline), opts ...SubOption) error
 	ExchangeName() string
 }
+
+// ClientOrderPlacer is implemented by exchanges which take a client order ID
+// along with a limit order and return it in OpenOrders and GetOrderHistory,
+// so that an order can be found after its response was lost
+type ClientOrderPlacer interface {
+	PlaceLimitOrder(clientOrderID string, side TradeSide, amount, price float64, pair CurrencyPair) (*Order, error)
+}
@@ -0,0 +1,91 @@
+package goup
+
+import "sync"
+
+// DefaultBatchConcurrency bounds the requests in flight when a batch is
+// fanned out to single order requests, adapters let it be tuned per client
+// since rate limits differ by exchange
+const DefaultBatchConcurrency = 4
+
+// OrderRequest is a limit order of a batch
+type OrderRequest struct {
+	Pair CurrencyPair
+	Side TradeSide
+	Price,
+	Amount float64
+}
+
+// OrderResult is the outcome of an order of a batch, in the same position
+type OrderResult struct {
+	Order *Order
+	Err   error
+}
+
+// CancelResult is the outcome of canceling an order of a batch
+type CancelResult struct {
+	OrderID string
+	Err     error
+}
+
+type (
+	// LimitPlacer is the part of API needed to place orders one by one
+	LimitPlacer interface {
+		LimitBuy(amount, price float64, pair CurrencyPair) (*Order, error)
+		LimitSell(amount, price float64, pair CurrencyPair) (*Order, error)
+	}
+
+	// OrderCanceler is the part of API needed to cancel orders one by one
+	OrderCanceler interface {
+		CancelOrder(orderID string, pair CurrencyPair) (bool, error)
+	}
+)
+
+// PlaceEach places orders with at most concurrency requests at once, for
+// exchanges without a batch endpoint
+func PlaceEach(p LimitPlacer, reqs []*OrderRequest, concurrency int) []*OrderResult {
+	results := make([]*OrderResult, len(reqs))
+	fanOut(len(reqs), concurrency, func(i int) {
+		req := reqs[i]
+		var r OrderResult
+		if req.Side == Buy {
+			r.Order, r.Err = p.LimitBuy(req.Amount, req.Price, req.Pair)
+		} else {
+			r.Order, r.Err = p.LimitSell(req.Amount, req.Price, req.Pair)
+		}
+		results[i] = &r
+	})
+
+	return results
+}
+
+// CancelEach cancels orders of pair with at most concurrency requests at once,
+// for exchanges without a batch endpoint
+func CancelEach(c OrderCanceler, pair CurrencyPair, orderIDs []string, concurrency int) []*CancelResult {
+	results := make([]*CancelResult, len(orderIDs))
+	fanOut(len(orderIDs), concurrency, func(i int) {
+		_, err := c.CancelOrder(orderIDs[i], pair)
+		results[i] = &CancelResult{OrderID: orderIDs[i], Err: err}
+	})
+
+	return results
+}
+
+// fanOut calls fn for 0 to n-1 with at most limit calls at once
+func fanOut(n, limit int, fn func(i int)) {
+	if limit < 1 {
+		limit = 1
+	}
+
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,92 @@
+package goup
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// slowTrader records how many requests run at once
+type slowTrader struct {
+	lock           sync.Mutex
+	inFlight, peak int
+}
+
+func (s *slowTrader) enter() {
+	s.lock.Lock()
+	s.inFlight++
+	if s.inFlight > s.peak {
+		s.peak = s.inFlight
+	}
+	s.lock.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+
+	s.lock.Lock()
+	s.inFlight--
+	s.lock.Unlock()
+}
+
+func (s *slowTrader) LimitBuy(amount, price float64, pair CurrencyPair) (*Order, error) {
+	s.enter()
+	if price <= 0 {
+		return nil, errors.New("invalid price")
+	}
+	return &Order{OrderID: fmt.Sprint(price), Side: Buy}, nil
+}
+
+func (s *slowTrader) LimitSell(amount, price float64, pair CurrencyPair) (*Order, error) {
+	s.enter()
+	return &Order{OrderID: fmt.Sprint(price), Side: Sell}, nil
+}
+
+func (s *slowTrader) CancelOrder(orderID string, pair CurrencyPair) (bool, error) {
+	s.enter()
+	if orderID == "gone" {
+		return false, errors.New("order not found")
+	}
+	return true, nil
+}
+
+func TestPlaceEach(t *testing.T) {
+	s := &slowTrader{}
+	var reqs []*OrderRequest
+	for i := 0; i < 10; i++ {
+		reqs = append(reqs, &OrderRequest{Side: TradeSide(i % 2), Price: float64(i), Amount: 1})
+	}
+
+	results := PlaceEach(s, reqs, 3)
+	if len(results) != len(reqs) {
+		t.Fatalf("got %d results, want %d", len(results), len(reqs))
+	}
+
+	// the buy at price 0 is rejected
+	if results[0].Err == nil || results[0].Order != nil {
+		t.Errorf("result 0: %+v", results[0])
+	}
+	for i, r := range results[1:] {
+		if r.Err != nil || r.Order.OrderID != fmt.Sprint(i+1) || r.Order.Side != reqs[i+1].Side {
+			t.Errorf("result %d: %+v", i+1, r)
+		}
+	}
+
+	if s.peak > 3 {
+		t.Errorf("%d requests at once, limit is 3", s.peak)
+	}
+}
+
+func TestCancelEach(t *testing.T) {
+	s := &slowTrader{}
+	results := CancelEach(s, CurrencyPair{}, []string{"1", "gone", "3"}, 0)
+	if len(results) != 3 || results[0].Err != nil || results[1].Err == nil || results[2].Err != nil ||
+		results[1].OrderID != "gone" {
+		t.Errorf("got %+v", results)
+	}
+
+	// a limit below 1 sends one request at a time
+	if s.peak != 1 {
+		t.Errorf("%d requests at once, want 1", s.peak)
+	}
+}
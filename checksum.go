@@ -0,0 +1,37 @@
+package goup
+
+import (
+	"hash/crc32"
+	"strconv"
+	"strings"
+)
+
+// ChecksumFunc computes the checksum of a local order book the same way an
+// exchange does, so the book can be verified against the published one.
+type ChecksumFunc func(ob *OrderBook) uint32
+
+// InterleavedCRC32 returns the checksum used by several exchanges(e.g. okex):
+// CRC32 over the best n levels joined by ':' as "bid:amount:ask:amount:...",
+// when one side is shorter the remaining levels of the other side follow.
+// Prices are formatted in their shortest representation, which must match
+// the strings pushed by the exchange.
+func InterleavedCRC32(n int) ChecksumFunc {
+	return func(ob *OrderBook) uint32 {
+		top := ob.TopN(n)
+		fields := make([]string, 0, 4*n)
+		for i := 0; i < len(top.BidList) || i < len(top.AskList); i++ {
+			if i < len(top.BidList) {
+				fields = append(fields, formatFloat(top.BidList[i].Price), formatFloat(top.BidList[i].Amount))
+			}
+			if i < len(top.AskList) {
+				fields = append(fields, formatFloat(top.AskList[i].Price), formatFloat(top.AskList[i].Amount))
+			}
+		}
+
+		return crc32.ChecksumIEEE([]byte(strings.Join(fields, ":")))
+	}
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
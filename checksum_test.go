@@ -0,0 +1,63 @@
+package goup
+
+import (
+	"errors"
+	"hash/crc32"
+	"testing"
+)
+
+func TestInterleavedCRC32(t *testing.T) {
+	ob := NewOrderBook(NewCurrencyPair("LYM", "ETH"))
+	ob.SetChecksum(InterleavedCRC32(2))
+	ob.Reset(&Depth{
+		AskList: DepthRecords{{Price: 3366.8, Amount: 9}, {Price: 3368, Amount: 8}, {Price: 3370, Amount: 1}},
+		BidList: DepthRecords{{Price: 3366.1, Amount: 7}},
+	})
+
+	want := crc32.ChecksumIEEE([]byte("3366.1:7:3366.8:9:3368:8"))
+	if got := InterleavedCRC32(2)(ob); got != want {
+		t.Fatalf("got checksum %d, want %d", got, want)
+	}
+
+	// a delta without checksum isn't verified
+	if err := ob.Update(&Depth{BidList: DepthRecords{{Price: 3366.1, Amount: 5}}}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	want = crc32.ChecksumIEEE([]byte("3366.1:5:3366.8:9:3368:8"))
+	if err := ob.Update(&Depth{Checksum: want}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if err := ob.Update(&Depth{AskList: DepthRecords{{Price: 3368, Amount: 0}}, Checksum: want}); err != ErrChecksum {
+		t.Errorf("got %v, want ErrChecksum", err)
+	}
+
+	if ob.Mismatches() != 1 {
+		t.Errorf("got %d mismatches, want 1", ob.Mismatches())
+	}
+}
+
+func TestOrderBooksResync(t *testing.T) {
+	pair := NewCurrencyPair("LYM", "ETH")
+	obs := NewOrderBooks()
+	obs.SetChecksum(InterleavedCRC32(2))
+	obs.Reset(&Depth{Pair: pair, AskList: DepthRecords{{Price: 2, Amount: 1}}, BidList: DepthRecords{{Price: 1, Amount: 1}}})
+
+	if _, err := obs.Update(&Depth{Pair: pair, Checksum: 1}); err != ErrChecksum {
+		t.Fatalf("got %v, want ErrChecksum", err)
+	}
+
+	// the book is gone until the next snapshot, the counts stay
+	if _, err := obs.Update(&Depth{Pair: pair}); err != ErrNoOrderBook {
+		t.Errorf("got %v, want ErrNoOrderBook", err)
+	}
+	if obs.Snapshot(pair) != nil || obs.Mismatches() != 1 || obs.Resyncs() != 1 {
+		t.Errorf("got %d mismatches, %d resyncs", obs.Mismatches(), obs.Resyncs())
+	}
+
+	obs.Reset(&Depth{Pair: pair, AskList: DepthRecords{{Price: 2, Amount: 1}}})
+	if _, err := obs.Apply(pair, func(ob *OrderBook) error { return errors.New("bad delta") }); err == nil || obs.Resyncs() != 2 || obs.Mismatches() != 1 {
+		t.Errorf("got %v, %d mismatches, %d resyncs", err, obs.Mismatches(), obs.Resyncs())
+	}
+}
@@ -5,36 +5,69 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"io/ioutil"
+	"log"
+	"math"
 	"net/http"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/gorilla/websocket"
 	"github.com/jflyup/goup"
+	"github.com/jflyup/goup/poller"
 	"github.com/jflyup/goup/util"
 )
 
+var baseURL = "https://api.cobinhood.com"
+
 const (
-	baseURL = "https://api.cobinhood.com"
+	// klines are not pushed via websocket, they're polled instead
+	pollInterval = 5 * time.Second
+	// the finest precision of order books
+	defaultPrecision = "1E-7"
 )
 
+// timeframes supported by the candles endpoint
+var timeframes = map[goup.KlineInterval]string{
+	goup.KlineInterval1Min:  "1m",
+	goup.KlineInterval5Min:  "5m",
+	goup.KlineInterval15Min: "15m",
+	goup.KlineInterval30Min: "30m",
+	goup.KlineInterval1H:    "1h",
+	goup.KlineInterval1Day:  "1D",
+}
+
+var _ goup.API = (*Client)(nil)
+
 type Client struct {
-	apiKey       string
-	wsConn       *websocket.Conn
-	createWsLock sync.Mutex
-	writeLock    sync.Mutex
-	pubsub       *util.PubSub
+	apiKey string
+	ws     *util.WsPool
+	pubsub *util.PubSub
+	poller *poller.Poller
+	// local order books by precision
+	orderBooks   map[string]*goup.OrderBooks
+	bookLock     sync.Mutex
 	currencyInfo map[goup.Currency]Currency
+	// batchConcurrency bounds the requests in flight of batches
+	batchConcurrency int
+	// maxSlippage caps the emulated market orders, see util.MarketBuy
+	maxSlippage float64
 }
 
 func NewClient(apiKey string) (*Client, error) {
 	client := &Client{
 		apiKey:       apiKey,
 		currencyInfo: make(map[goup.Currency]Currency),
+		pubsub:       util.NewPubSub(16),
+		poller:       poller.New(pollInterval),
+		orderBooks:   make(map[string]*goup.OrderBooks),
+
+		batchConcurrency: goup.DefaultBatchConcurrency,
+		maxSlippage:      util.DefaultMaxSlippage,
 	}
+	client.ws = util.NewWsPool(wsBaseURL, client.handleWsMsg)
 
 	if err := client.currencies(); err != nil {
 		return nil, err
@@ -43,8 +76,35 @@ func NewClient(apiKey string) (*Client, error) {
 	return client, nil
 }
 
-func (c *Client) OpenOrders() ([]*goup.Order, error) {
-	return nil, errors.New("not implemented")
+// OpenOrders implements the API interface
+func (c *Client) OpenOrders(pair goup.CurrencyPair) ([]*goup.Order, error) {
+	rsp, err := c.get("/v1/trading/orders?trading_pair_id=" + pair.ToSymbol("-"))
+	if err != nil {
+		return nil, err
+	}
+
+	var orders []*goup.Order
+	for _, o := range rsp.Result.Orders {
+		orders = append(orders, toOrder(&o, pair))
+	}
+
+	return orders, nil
+}
+
+// GetOrderHistory implements the API interface, currentPage starts at 1
+func (c *Client) GetOrderHistory(pair goup.CurrencyPair, currentPage, pageSize int) ([]goup.Order, error) {
+	rsp, err := c.get(fmt.Sprintf("/v1/trading/order_history?trading_pair_id=%s&page=%d&limit=%d",
+		pair.ToSymbol("-"), currentPage, pageSize))
+	if err != nil {
+		return nil, err
+	}
+
+	var orders []goup.Order
+	for _, o := range rsp.Result.Orders {
+		orders = append(orders, *toOrder(&o, pair))
+	}
+
+	return orders, nil
 }
 
 func (c *Client) AllSymbols() ([]goup.CurrencyPair, error) {
@@ -70,7 +130,11 @@ func (c *Client) GetOrder(orderID string, pair goup.CurrencyPair) (*goup.Order,
 		return nil, err
 	}
 
-	order := rsp.Result.Order
+	return toOrder(&rsp.Result.Order, pair), nil
+}
+
+// toOrder converts an order of the trading endpoints
+func toOrder(order *Order, pair goup.CurrencyPair) *goup.Order {
 	// [queued, open, partially_filled, filled, cancelled, rejected,
 	// pending_cancellation, pending_modifications, triggered]
 	ord := &goup.Order{
@@ -78,10 +142,9 @@ func (c *Client) GetOrder(orderID string, pair goup.CurrencyPair) (*goup.Order,
 		Amount:     util.ToFloat64(order.Size),
 		DealAmount: util.ToFloat64(order.Filled),
 		Fee:        0, // zero trading fee!
-		OrderID:    orderID,
-		// CreateTime int64 // in ms
-		// FinishTime int64
-		Currency: pair,
+		OrderID:    order.ID,
+		CreateTime: order.Timestamp,
+		Currency:   pair,
 	}
 
 	switch order.State {
@@ -103,7 +166,7 @@ func (c *Client) GetOrder(orderID string, pair goup.CurrencyPair) (*goup.Order,
 		ord.Side = goup.Buy
 	}
 
-	return ord, nil
+	return ord
 }
 
 func (c *Client) CancelOrder(orderID string, pair goup.CurrencyPair) (bool, error) {
@@ -116,6 +179,63 @@ func (c *Client) CancelOrder(orderID string, pair goup.CurrencyPair) (bool, erro
 	return true, nil
 }
 
+// ReplaceOrder implements the API interface by modifying the order in place.
+// The size sent is the total size of the order like amount, fills included,
+// so cobinhood leaves amount minus the fills open.
+func (c *Client) ReplaceOrder(orderID string, pair goup.CurrencyPair, price, amount float64) (*goup.Replacement, error) {
+	old, err := c.GetOrder(orderID, pair)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &goup.Replacement{Old: old}
+	if old.DealAmount >= amount {
+		return r, nil
+	}
+
+	data, _ := json.Marshal(map[string]string{
+		"trading_pair_id": pair.ToSymbol("-"),
+		"price":           fmt.Sprintf("%.8f", price),
+		"size":            fmt.Sprint(amount),
+	})
+
+	if _, err := c.put(fmt.Sprintf("/v1/trading/orders/%s", orderID), bytes.NewReader(data)); err != nil {
+		return r, err
+	}
+
+	if r.New, err = c.GetOrder(orderID, pair); err != nil {
+		return r, err
+	}
+
+	r.Replaced = r.New.Amount - r.New.DealAmount
+	return r, nil
+}
+
+// PlaceOrders implements the API interface, orders are placed one by one
+func (c *Client) PlaceOrders(reqs []*goup.OrderRequest) ([]*goup.OrderResult, error) {
+	return goup.PlaceEach(c, reqs, c.batchConcurrency), nil
+}
+
+// CancelOrders implements the API interface, orders are canceled one by one
+func (c *Client) CancelOrders(pair goup.CurrencyPair, orderIDs []string) ([]*goup.CancelResult, error) {
+	return goup.CancelEach(c, pair, orderIDs, c.batchConcurrency), nil
+}
+
+// CancelAll implements the API interface
+func (c *Client) CancelAll(pair goup.CurrencyPair) ([]*goup.CancelResult, error) {
+	open, err := c.OpenOrders(pair)
+	if err != nil {
+		return nil, err
+	}
+
+	var orderIDs []string
+	for _, o := range open {
+		orderIDs = append(orderIDs, o.OrderID)
+	}
+
+	return goup.CancelEach(c, pair, orderIDs, c.batchConcurrency), nil
+}
+
 func (c *Client) get(path string) (*Response, error) {
 	req, err := c.request("GET", path, nil)
 
@@ -131,16 +251,16 @@ func (c *Client) get(path string) (*Response, error) {
 
 	defer rsp.Body.Close()
 
-	if rsp.StatusCode > 399 {
-		return nil, fmt.Errorf("HTTP Status Code: %d ", rsp.StatusCode)
-	}
-
 	data, err := ioutil.ReadAll(rsp.Body)
 
 	if err != nil {
 		return nil, err
 	}
 
+	if rsp.StatusCode > 399 {
+		return nil, &goup.HttpError{StatusCode: rsp.StatusCode, Reply: string(data)}
+	}
+
 	jsonRsp := &Response{}
 	err = json.Unmarshal(data, jsonRsp)
 
@@ -156,7 +276,16 @@ func (c *Client) get(path string) (*Response, error) {
 }
 
 func (c *Client) post(path string, body io.Reader) (*Response, error) {
-	req, err := c.request("POST", path, body)
+	return c.send("POST", path, body)
+}
+
+func (c *Client) put(path string, body io.Reader) (*Response, error) {
+	return c.send("PUT", path, body)
+}
+
+// send sends a json body
+func (c *Client) send(method, path string, body io.Reader) (*Response, error) {
+	req, err := c.request(method, path, body)
 	if err != nil {
 		return nil, err
 	}
@@ -170,17 +299,17 @@ func (c *Client) post(path string, body io.Reader) (*Response, error) {
 
 	defer rsp.Body.Close()
 
-	if rsp.StatusCode > 399 {
-		return nil, fmt.Errorf("response status: %d ", rsp.StatusCode)
-	}
-
 	data, err := ioutil.ReadAll(rsp.Body)
 
 	if err != nil {
 		return nil, err
 	}
 
-	var jsonRsp *Response
+	if rsp.StatusCode > 399 {
+		return nil, &goup.HttpError{StatusCode: rsp.StatusCode, Reply: string(data)}
+	}
+
+	jsonRsp := &Response{}
 	err = json.Unmarshal(data, jsonRsp)
 
 	if err != nil {
@@ -198,7 +327,7 @@ func (c *Client) delete(path string) error {
 	req, err := c.request("DELETE", path, nil)
 
 	if err != nil {
-		return nil
+		return err
 	}
 
 	rsp, err := c.client().Do(req)
@@ -214,7 +343,11 @@ func (c *Client) delete(path string) error {
 		return err
 	}
 
-	var jsonRsp *Response
+	if rsp.StatusCode > 399 {
+		return &goup.HttpError{StatusCode: rsp.StatusCode, Reply: string(data)}
+	}
+
+	jsonRsp := &Response{}
 	err = json.Unmarshal(data, jsonRsp)
 
 	if err != nil {
@@ -266,7 +399,47 @@ func (c *Client) ExchangeName() string {
 	return goup.Cobinhood
 }
 
+// SetBatchConcurrency sets how many requests PlaceOrders, CancelOrders and
+// CancelAll send at once
+func (c *Client) SetBatchConcurrency(n int) {
+	c.batchConcurrency = n
+}
+
+// SetMaxSlippage sets how far from the best price MarketBuy and MarketSell
+// may go, as a fraction of it
+func (c *Client) SetMaxSlippage(s float64) {
+	c.maxSlippage = s
+}
+
+// WsPool returns the websocket connections of the client, tune it before subscribing
+func (c *Client) WsPool() *util.WsPool {
+	return c.ws
+}
+
+// LimitBuy implements the API interface
 func (c *Client) LimitBuy(amount, price float64, pair goup.CurrencyPair) (*goup.Order, error) {
+	return c.placeOrder(amount, price, pair, goup.Buy)
+}
+
+// LimitSell implements the API interface, cobinhood calls sells asks
+func (c *Client) LimitSell(amount, price float64, pair goup.CurrencyPair) (*goup.Order, error) {
+	return c.placeOrder(amount, price, pair, goup.Sell)
+}
+
+// MarketBuy implements the API interface, amount is in quote currency while
+// cobinhood sizes market orders in base currency, so it's emulated with a
+// limit order
+func (c *Client) MarketBuy(amount, price float64, pair goup.CurrencyPair) (*goup.Order, error) {
+	return util.MarketBuy(c, amount, price, c.maxSlippage, pair)
+}
+
+// MarketSell implements the API interface, emulated like MarketBuy so that
+// price bounds it
+func (c *Client) MarketSell(amount, price float64, pair goup.CurrencyPair) (*goup.Order, error) {
+	return util.MarketSell(c, amount, price, c.maxSlippage, pair)
+}
+
+func (c *Client) placeOrder(amount, price float64, pair goup.CurrencyPair, side goup.TradeSide) (*goup.Order, error) {
 	// data := new(bytes.Buffer)
 	// err := json.NewEncoder(data).Encode(datajson)
 	info, ok := c.currencyInfo[pair.Base]
@@ -286,11 +459,13 @@ func (c *Client) LimitBuy(amount, price float64, pair goup.CurrencyPair) (*goup.
 
 	params := PlaceOrder{
 		TradingPairId: pair.ToSymbol("-"),
-		// TODO
-		Side:  "bid",
-		Type:  "limit",
-		Price: fmt.Sprintf("%.8f", price),
-		Size:  fmt.Sprint(amount),
+		Side:          "bid",
+		Type:          "limit",
+		Price:         fmt.Sprintf("%.8f", price),
+		Size:          fmt.Sprint(amount),
+	}
+	if side == goup.Sell {
+		params.Side = "ask"
 	}
 
 	data, _ := json.Marshal(params)
@@ -312,7 +487,7 @@ func (c *Client) LimitBuy(amount, price float64, pair goup.CurrencyPair) (*goup.
 		// CreateTime int64 // in ms
 		// FinishTime int64
 		Currency: pair,
-		Side:     goup.Buy,
+		Side:     side,
 	}
 
 	switch order.State {
@@ -353,64 +528,215 @@ func (c *Client) GetAccount() (*goup.Account, error) {
 	return acc, nil
 }
 
-func (c *Client) WsDepth(pair goup.CurrencyPair, handler func(*goup.Depth)) error {
-	// available precisions could be acquired from REST,
-	// endpoint: /v1/market/orderbook/precisions/<trading_pair_id>
-	// if rsp, err := c.get("/v1/market/orderbook/precisions/"); err != nil {
-	// 	return err
-	// }
-	// "result": [
-	// 	"1E-7",
-	// 	"5E-7",
-	// ]
-	if err := c.createWsConn(); err != nil {
-		return err
+// GetTicker implements the API interface
+func (c *Client) GetTicker(pair goup.CurrencyPair) (*goup.Ticker, error) {
+	rsp, err := c.get("/v1/market/tickers/" + pair.ToSymbol("-"))
+	if err != nil {
+		return nil, err
+	}
+
+	t := rsp.Result.Ticker
+	return &goup.Ticker{
+		Last: util.ToFloat64(t.Last),
+		Buy:  util.ToFloat64(t.Bid),
+		Sell: util.ToFloat64(t.Ask),
+		High: util.ToFloat64(t.High),
+		Low:  util.ToFloat64(t.Low),
+		Vol:  util.ToFloat64(t.Volume),
+		Date: uint64(t.Timestamp),
+	}, nil
+}
+
+// GetDepth implements the API interface
+func (c *Client) GetDepth(pair goup.CurrencyPair, size int) (*goup.Depth, error) {
+	rsp, err := c.get(fmt.Sprintf("/v1/market/orderbooks/%s?limit=%d", pair.ToSymbol("-"), size))
+	if err != nil {
+		return nil, err
+	}
+
+	book := rsp.Result.Orderbook
+	d := &goup.Depth{Pair: pair, Seq: uint64(book.Sequence), LocalTs: util.NowMs()}
+	for _, ask := range book.Asks {
+		d.AskList = append(d.AskList, goup.DepthRecord{Price: util.ToFloat64(ask[0]), Amount: util.ToFloat64(ask[2])})
+	}
+
+	for _, bid := range book.Bids {
+		d.BidList = append(d.BidList, goup.DepthRecord{Price: util.ToFloat64(bid[0]), Amount: util.ToFloat64(bid[2])})
+	}
+
+	d.Normalize()
+	d.Truncate(size)
+	return d, nil
+}
+
+// GetTrades implements the API interface, cobinhood ignores since and
+// returns the latest trades
+func (c *Client) GetTrades(pair goup.CurrencyPair, since int64) ([]*goup.Trade, error) {
+	rsp, err := c.get(fmt.Sprintf("/v1/market/trades/%s?limit=50", pair.ToSymbol("-")))
+	if err != nil {
+		return nil, err
+	}
+
+	var trades []*goup.Trade
+	for _, t := range rsp.Result.Trades {
+		trades = append(trades, &goup.Trade{
+			Pair:   pair,
+			Tid:    tradeID(t.ID),
+			Type:   takerSide(t.MakerSide),
+			Amount: util.ToFloat64(t.Size),
+			Price:  util.ToFloat64(t.Price),
+			Ts:     t.Timestamp,
+		})
+	}
+
+	return trades, nil
+}
+
+// tradeID maps the UUID of a trade to a Tid
+func tradeID(id string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(id))
+	return int64(h.Sum64())
+}
+
+// takerSide returns the side of the taker of a trade, the other side of the maker
+func takerSide(makerSide string) string {
+	if makerSide == "bid" {
+		return "sell"
 	}
+	return "buy"
+}
 
-	if err := c.subscribe(map[string]interface{}{
+// WsDepth implements the API interface, a tick requested by goup.WithTick is
+// served by the exchange if it's one of the precisions of pair, otherwise
+// depth is regrouped locally.
+func (c *Client) WsDepth(pair goup.CurrencyPair, handler func(*goup.Depth), opts ...goup.SubOption) error {
+	cfg := goup.NewSubConfig(opts...)
+	precision, regroup := defaultPrecision, cfg.Tick
+	if cfg.Tick > 0 {
+		if p, err := c.precision(pair, cfg.Tick); err != nil {
+			log.Printf("precision %v unavailable for %s, regrouping locally: %v", cfg.Tick, pair, err)
+		} else {
+			precision, regroup = p, 0
+		}
+	}
+
+	topic := strings.Join([]string{"order-book", pair.ToSymbol("-"), precision}, ".")
+	if err := c.ws.Subscribe(topic, map[string]interface{}{
 		"action":          "subscribe",
 		"type":            "order-book",
 		"trading_pair_id": pair.ToSymbol("-"),
-		"precision":       "1E-7",
-	}, true); err != nil {
+		"precision":       precision,
+	}); err != nil {
 		return err
 	}
 
-	chDepth := c.pubsub.Sub(strings.Join([]string{"order-book", pair.ToSymbol("-"), "1E-7"}, "."))
+	chDepth := c.pubsub.SubWithPolicy(cfg.Backpressure, cfg.Dropped, topic)
 	go func() {
-		d := <-chDepth
-		depth := d.(*goup.Depth)
-		handler(depth)
+		for d := range chDepth {
+			handler(d.(*goup.Depth).Regroup(regroup))
+		}
 	}()
 
 	return nil
 }
 
-func (c *Client) WsTrades(pair goup.CurrencyPair, handler func([]*goup.Trade)) error {
-	if err := c.createWsConn(); err != nil {
-		return err
+// precision returns the order book precision of pair which equals tick
+func (c *Client) precision(pair goup.CurrencyPair, tick float64) (string, error) {
+	data, err := goup.NewHttpRequest(c.client(), "GET", baseURL+"/v1/market/orderbook/precisions/"+pair.ToSymbol("-"), "", nil)
+	if err != nil {
+		return "", err
+	}
+
+	// unlike other endpoints the result is an array, e.g. ["1E-7", "5E-7"]
+	rsp := struct {
+		Success bool
+		Result  []string
+		Error   errorMsg
+	}{}
+	if err := json.Unmarshal(data, &rsp); err != nil {
+		return "", err
+	}
+
+	if !rsp.Success {
+		return "", errors.New(rsp.Error.Err)
+	}
+
+	for _, p := range rsp.Result {
+		if v := util.ToFloat64(p); math.Abs(v-tick) < tick*1e-9 {
+			return p, nil
+		}
 	}
 
-	if err := c.subscribe(map[string]interface{}{
+	return "", errors.New("no such precision")
+}
+
+func (c *Client) WsTrades(pair goup.CurrencyPair, handler func([]*goup.Trade), opts ...goup.SubOption) error {
+	topic := strings.Join([]string{"trade", pair.ToSymbol("-")}, ".")
+	if err := c.ws.Subscribe(topic, map[string]interface{}{
 		"action":          "subscribe",
 		"type":            "trade",
 		"trading_pair_id": pair.ToSymbol("-"),
-	}, true); err != nil {
+	}); err != nil {
 		return err
 	}
 
-	chTrade := c.pubsub.Sub(strings.Join([]string{"trade", pair.ToSymbol("-")}, "."))
+	cfg := goup.NewSubConfig(opts...)
+	chTrade := c.pubsub.SubWithPolicy(cfg.Backpressure, cfg.Dropped, topic)
 	go func() {
-		t := <-chTrade
-		trade := t.(*goup.Trade)
-		handler([]*goup.Trade{trade})
+		for t := range chTrade {
+			handler(t.([]*goup.Trade))
+		}
 	}()
 
 	return nil
 }
 
-func (c *Client) WsKlines(pair goup.CurrencyPair, interval goup.KlineInterval, handler func(*goup.Kline)) error {
-	return errors.New("not implemented")
+// GetKlines implements the API interface, since is in ms
+func (c *Client) GetKlines(pair goup.CurrencyPair, interval goup.KlineInterval, size, since int) ([]*goup.Kline, error) {
+	timeframe, ok := timeframes[interval]
+	if !ok {
+		return nil, errors.New("unsupported interval")
+	}
+
+	end := time.Now().Unix() * 1000
+	start := int64(since)
+	if start == 0 {
+		start = end - int64(interval)*int64(size)*60*1000
+	}
+
+	rsp, err := c.get(fmt.Sprintf("/v1/chart/candles/%s?timeframe=%s&start_time=%d&end_time=%d",
+		pair.ToSymbol("-"), timeframe, start, end))
+	if err != nil {
+		return nil, err
+	}
+
+	var klines []*goup.Kline
+	for _, k := range rsp.Result.Candles {
+		klines = append(klines, &goup.Kline{
+			Pair:     pair,
+			Ts:       k.Timestamp,
+			OpenTime: k.Timestamp,
+			Open:     util.ToFloat64(k.Open),
+			Close:    util.ToFloat64(k.Close),
+			High:     util.ToFloat64(k.High),
+			Low:      util.ToFloat64(k.Low),
+			Vol:      util.ToFloat64(k.Volume),
+		})
+	}
+
+	return klines, nil
+}
+
+// WsKlines implements the API interface, cobinhood doesn't push klines
+// so they are polled from GetKlines
+func (c *Client) WsKlines(pair goup.CurrencyPair, interval goup.KlineInterval, handler func(*goup.Kline), opts ...goup.SubOption) error {
+	if _, ok := timeframes[interval]; !ok {
+		return errors.New("unsupported interval")
+	}
+
+	c.poller.Klines(c, pair, interval, handler)
+	return nil
 }
 
 // 0: limit
@@ -432,7 +758,7 @@ func (c *Client) WsLimitBuy(amount, price float64, pair goup.CurrencyPair) (*gou
 		Size:  fmt.Sprint(amount),
 	}
 
-	err := c.subscribe(params, false)
+	err := c.ws.Send("", params)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,169 @@
+package cobinhood
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jflyup/goup"
+	"github.com/jflyup/goup/oms"
+	"github.com/jflyup/goup/util"
+)
+
+var pair = goup.NewCurrencyPair("COB", "ETH")
+
+// fakeServer serves the REST endpoints of cobinhood with handler, the client
+// talks to it until the returned func is called
+func fakeServer(handler http.HandlerFunc) (*Client, func()) {
+	srv := httptest.NewServer(handler)
+	url := baseURL
+	baseURL = srv.URL
+
+	c := &Client{currencyInfo: map[goup.Currency]Currency{pair.Base: {MinUnit: "0.001"}}}
+	return c, func() {
+		baseURL = url
+		srv.Close()
+	}
+}
+
+func TestCancelOrder(t *testing.T) {
+	c, done := fakeServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" {
+			http.Error(w, "", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if r.URL.Path == "/v1/trading/orders/1" {
+			fmt.Fprint(w, `{"success": true, "result": {}}`)
+			return
+		}
+		fmt.Fprint(w, `{"success": false, "error": {"error_code": "order_not_found"}}`)
+	})
+	defer done()
+
+	if ok, err := c.CancelOrder("1", pair); !ok || err != nil {
+		t.Errorf("got %v, %v", ok, err)
+	}
+
+	if ok, err := c.CancelOrder("2", pair); ok || err == nil || err.Error() != "order_not_found" {
+		t.Errorf("got %v, %v, want order_not_found", ok, err)
+	}
+}
+
+// TestReplaceOrder checks that the size sent is the total, not what's left
+func TestReplaceOrder(t *testing.T) {
+	size, price := "10", "0.00010000"
+	c, done := fakeServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/trading/orders/1" {
+			http.NotFound(w, r)
+			return
+		}
+
+		if r.Method == "PUT" {
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			if body["trading_pair_id"] != "COB-ETH" {
+				fmt.Fprint(w, `{"success": false, "error": {"error_code": "invalid_trading_pair"}}`)
+				return
+			}
+			size, price = body["size"], body["price"]
+			fmt.Fprint(w, `{"success": true, "result": {}}`)
+			return
+		}
+
+		fmt.Fprintf(w, `{"success": true, "result": {"order": {"id": "1", "state": "partially_filled", "side": "bid", "price": "%s", "size": "%s", "filled": "4"}}}`, price, size)
+	})
+	defer done()
+
+	r, err := c.ReplaceOrder("1", pair, 0.0002, 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if size != "12" || price != "0.00020000" {
+		t.Errorf("sent size %s at %s, want the total 12", size, price)
+	}
+	if r.Old.Amount != 10 || r.New.Amount != 12 || r.New.Price != 0.0002 || r.Replaced != 8 {
+		t.Errorf("got %+v %+v, replaced %v", r.Old, r.New, r.Replaced)
+	}
+
+	// what filled already can't be replaced
+	if r, err := c.ReplaceOrder("1", pair, 0.0002, 4); err != nil || r.New != nil {
+		t.Errorf("got %+v, %v", r, err)
+	}
+}
+
+func TestLimitOrders(t *testing.T) {
+	var sent string
+	c, done := fakeServer(func(w http.ResponseWriter, r *http.Request) {
+		var order PlaceOrder
+		json.NewDecoder(r.Body).Decode(&order)
+		sent = order.Side
+		fmt.Fprintf(w, `{"success": true, "result": {"order": {"id": "1", "state": "open", "side": "%s", "type": "%s", "price": "%s", "size": "%s", "filled": "0"}}}`,
+			order.Side, order.Type, order.Price, order.Size)
+	})
+	defer done()
+
+	for _, table := range []struct {
+		side  goup.TradeSide
+		place func(amount, price float64, pair goup.CurrencyPair) (*goup.Order, error)
+		sent  string
+	}{
+		{goup.Buy, c.LimitBuy, "bid"},
+		{goup.Sell, c.LimitSell, "ask"},
+	} {
+		// the size is truncated to the min unit of the base currency
+		o, err := table.place(1.2345, 0.0001, pair)
+		if err != nil || sent != table.sent || o.Side != table.side || o.Amount != 1.234 || o.Price != 0.0001 {
+			t.Errorf("%s: sent %s, got %+v, %v", table.side, sent, o, err)
+		}
+	}
+}
+
+func TestWsTrades(t *testing.T) {
+	c := &Client{pubsub: util.NewPubSub(16)}
+	defer c.pubsub.Shutdown()
+	ch := c.pubsub.Sub("trade.COB-ETH")
+
+	c.handleWsMsg([]byte(`{"h": ["trade.COB-ETH", "2", "u"], "d": [["a1", "1540000000000", "bid", "0.0001", "10"], ["a2", "1540000000001", "ask", "0.00011", "2"]]}`))
+
+	select {
+	case msg := <-ch:
+		trades := msg.([]*goup.Trade)
+		if len(trades) != 2 {
+			t.Fatalf("got %d trades, want 2", len(trades))
+		}
+		if tr := trades[0]; tr.Pair != pair || tr.Type != "sell" || tr.Price != 0.0001 || tr.Amount != 10 || tr.Ts != 1540000000000 {
+			t.Errorf("got %+v", tr)
+		}
+		if trades[1].Type != "buy" || trades[0].Tid == trades[1].Tid {
+			t.Errorf("got %+v", trades[1])
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no trades published")
+	}
+}
+
+// TestServerError checks that a 5xx leaves it unknown whether an order was
+// placed, it may have been accepted before the gateway failed
+func TestServerError(t *testing.T) {
+	c, done := fakeServer(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+	})
+	defer done()
+
+	if _, err := c.CancelOrder("1", pair); err == nil {
+		t.Error("canceled despite the 502")
+	}
+
+	m := oms.New(0, c)
+	defer m.Close()
+	m.SetRetries(0)
+	_, err := m.Place(&oms.Request{Exchange: goup.Cobinhood, Pair: pair, Side: goup.Buy, Price: 0.0001, Amount: 1})
+	if _, ok := err.(*oms.AmbiguousError); !ok {
+		t.Errorf("got %v, want an AmbiguousError", err)
+	}
+}
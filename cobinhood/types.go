@@ -62,12 +62,49 @@ type Result struct {
 	QuoteCurrencies []Currency `json:"quote_currencies"`
 	Balances        []balance
 	TradingPairs    []TradingPair `json:"trading_pairs"`
-	// Orderbook    Orderbook    `json:"orderbook"`
-	// Ticker       Ticker       `json:"ticker"`
-	// Trades       Trades       `json:"trades"`
-	Order  Order   `json:"order"`
-	Orders []Order `json:"orders"`
-	Error  string  `json:"error"`
+	Orderbook       orderbook     `json:"orderbook"`
+	Ticker          ticker        `json:"ticker"`
+	Trades          []trade       `json:"trades"`
+	Order           Order         `json:"order"`
+	Orders          []Order       `json:"orders"`
+	Candles         []candle      `json:"candles"`
+	Error           string        `json:"error"`
+}
+
+type ticker struct {
+	Timestamp int64  `json:"timestamp"`
+	High      string `json:"24h_high"`
+	Low       string `json:"24h_low"`
+	Volume    string `json:"24h_volume"`
+	Last      string `json:"last_trade_price"`
+	Bid       string `json:"highest_bid"`
+	Ask       string `json:"lowest_ask"`
+}
+
+// orderbook records are triplets of [price, order count, size]
+type orderbook struct {
+	Sequence int64
+	Bids     [][]string
+	Asks     [][]string
+}
+
+type trade struct {
+	ID        string `json:"id"`
+	MakerSide string `json:"maker_side"`
+	Timestamp int64  `json:"timestamp"`
+	Price     string `json:"price"`
+	Size      string `json:"size"`
+}
+
+type candle struct {
+	Timeframe     string `json:"timeframe"`
+	TradingPairID string `json:"trading_pair_id"`
+	Timestamp     int64  `json:"timestamp"`
+	Volume        string `json:"volume"`
+	Open          string `json:"open"`
+	Close         string `json:"close"`
+	High          string `json:"high"`
+	Low           string `json:"low"`
 }
 
 type errorMsg struct {
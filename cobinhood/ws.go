@@ -7,34 +7,21 @@ import (
 
 	"github.com/jflyup/goup"
 	"github.com/jflyup/goup/util"
-
-	"github.com/gorilla/websocket"
 )
 
 var (
 	wsBaseURL = "wss://ws.cobinhood.com/v2/ws"
 )
 
-func (c *Client) createWsConn() error {
-	c.createWsLock.Lock()
-	defer c.createWsLock.Unlock()
-
-	if c.wsConn == nil {
-		var err error
-		if c.wsConn, _, err = websocket.DefaultDialer.Dial(wsBaseURL, nil); err != nil {
-			log.Printf("ERROR\thuobi websocket error: %v", err)
-			return err
-		}
-
-		c.pubsub = util.NewPubSub(16)
-		go c.wsLoop()
-	}
-	return nil
+// channelPair returns the pair of channel ch, e.g. trade.COB-ETH
+func channelPair(ch string) goup.CurrencyPair {
+	// ignore the returned error, this should be ok
+	pair, _ := goup.ParseSymbol(strings.Replace(strings.Split(ch, ".")[1], "-", "_", 1))
+	return pair
 }
 
 func transformDepth(ch string, d *wsDepth) *goup.Depth {
-	// ignore the returned error, this should be ok
-	pair, _ := goup.ParseSymbol(strings.Split(ch, ".")[1])
+	pair := channelPair(ch)
 	depth := &goup.Depth{
 		Pair:    pair,
 		AskList: make([]goup.DepthRecord, 0, len(d.Asks)),
@@ -61,50 +48,128 @@ func transformDepth(ch string, d *wsDepth) *goup.Depth {
 	return depth
 }
 
-func (c *Client) subscribe(subEvent interface{}, keep bool) error {
-	// Applications are responsible for ensuring that
-	// no more than one goroutine calls the write methods concurrently
-	// and that no more than one goroutine calls the read methods concurrently.
-	c.writeLock.Lock()
-	err := c.wsConn.WriteJSON(subEvent)
-	c.writeLock.Unlock()
-	if err != nil {
-		log.Printf("ERROR\twebsocket write error: %v", err)
-		return err
+// transformTrades converts the records of a trade frame, each one is
+// [trade id, timestamp, maker side, price, size]
+func transformTrades(ch string, records [][]string) []*goup.Trade {
+	pair := channelPair(ch)
+	trades := make([]*goup.Trade, 0, len(records))
+	for _, r := range records {
+		if len(r) < 5 {
+			continue
+		}
+
+		trades = append(trades, &goup.Trade{
+			Pair:   pair,
+			Tid:    tradeID(r[0]),
+			Ts:     util.ToInt64(r[1]),
+			Type:   takerSide(r[2]),
+			Price:  util.ToFloat64(r[3]),
+			Amount: util.ToFloat64(r[4]),
+		})
 	}
 
-	if keep {
-		// keep this for re-subscribe when reconnecting
+	return trades
+}
+
+// minAmount is the smallest size kept in a local book, sizes summed up from
+// update deltas may leave a tiny residue on removed levels
+const minAmount = 1e-10
+
+// books returns the local order books of channel ch, e.g. order-book.COB-ETH.1E-7,
+// books of different precisions are kept apart.
+func (c *Client) books(ch string) *goup.OrderBooks {
+	precision := ch[strings.LastIndex(ch, ".")+1:]
+
+	c.bookLock.Lock()
+	defer c.bookLock.Unlock()
+
+	obs, ok := c.orderBooks[precision]
+	if !ok {
+		obs = goup.NewOrderBooks()
+		c.orderBooks[precision] = obs
 	}
-	return nil
+
+	return obs
 }
 
-func (c *Client) wsLoop() {
-	var rsp wsRsp
-	depth := &wsDepth{}
-	for {
-		_, msg, err := c.wsConn.ReadMessage()
-		if err != nil {
-			log.Printf("ERROR\tfailed to read from huobi websocket: %v", err)
-			// if err := c.reconnectWs(); err != nil {
-			// 	log.Printf("ERROR\twebsocket reconnect error")
-			// 	return
-			// }
-			continue
+// applyDepthUpdate applies an update frame to the local book, each record is
+// a triplet of [price, order count change, size change]
+func (c *Client) applyDepthUpdate(ch string, seq uint64, d *wsDepth) (*goup.Depth, error) {
+	pair := channelPair(ch)
+	return c.books(ch).Apply(pair, func(ob *goup.OrderBook) error {
+		ob.Seq = seq
+		ob.LocalTs = util.NowMs()
+		for _, ask := range d.Asks {
+			price := util.ToFloat64(ask[0])
+			ob.UpdateAsk(goup.DepthRecord{Price: price, Amount: levelAmount(ob.AskAmount(price), ask)})
 		}
 
-		if err := json.Unmarshal(msg, &rsp); err != nil {
+		for _, bid := range d.Bids {
+			price := util.ToFloat64(bid[0])
+			ob.UpdateBid(goup.DepthRecord{Price: price, Amount: levelAmount(ob.BidAmount(price), bid)})
+		}
+
+		return nil
+	})
+}
+
+func levelAmount(current float64, update []string) float64 {
+	amount := current + util.ToFloat64(update[2])
+	if amount < minAmount {
+		return 0
+	}
+
+	return amount
+}
+
+func (c *Client) handleWsMsg(msg []byte) {
+	var rsp wsRsp
+	if err := json.Unmarshal(msg, &rsp); err != nil {
+		log.Printf("json.Unmarshal error: %v, raw msg: %s", err, string(msg))
+		return
+	}
+
+	if len(rsp.Header) < 3 {
+		return
+	}
+
+	if strings.Contains(rsp.Header[0], "order-book") {
+		depth := &wsDepth{}
+		if err := json.Unmarshal(rsp.Data, depth); err != nil {
 			log.Printf("json.Unmarshal error: %v, raw msg: %s", err, string(msg))
-			continue
+			return
 		}
 
-		if strings.Contains(rsp.Header[0], "order-book") && rsp.Header[2] == "s" {
-			if err := json.Unmarshal(rsp.Data, depth); err != nil {
-				log.Printf("json.Unmarshal error: %v, raw msg: %s", err, string(msg))
-				continue
+		// the second field of the header is the version of the book
+		seq := util.ToUint64(rsp.Header[1])
+		var snap *goup.Depth
+		switch rsp.Header[2] {
+		case "s":
+			d := transformDepth(rsp.Header[0], depth)
+			d.Seq = seq
+			d.LocalTs = util.NowMs()
+			snap = c.books(rsp.Header[0]).Reset(d)
+		case "u":
+			var err error
+			if snap, err = c.applyDepthUpdate(rsp.Header[0], seq, depth); err != nil {
+				log.Printf("failed to update order book %s: %v", rsp.Header[0], err)
+				return
 			}
+		default:
+			return
+		}
+
+		c.pubsub.Pub(snap, rsp.Header[0])
+	} else if strings.HasPrefix(rsp.Header[0], "trade.") {
+		// the snapshot holds the recent trades, updates the new ones
+		var records [][]string
+		if err := json.Unmarshal(rsp.Data, &records); err != nil {
+			log.Printf("json.Unmarshal error: %v, raw msg: %s", err, string(msg))
+			return
+		}
 
-			c.pubsub.Pub(transformDepth(rsp.Header[0], depth), rsp.Header[0])
+		if trades := transformTrades(rsp.Header[0], records); len(trades) > 0 {
+			c.pubsub.Pub(trades, rsp.Header[0])
 		}
 	}
 }
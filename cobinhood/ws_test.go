@@ -0,0 +1,59 @@
+package cobinhood
+
+import (
+	"testing"
+
+	"github.com/jflyup/goup"
+	"github.com/jflyup/goup/util"
+)
+
+func TestDepthUpdates(t *testing.T) {
+	c := &Client{
+		pubsub:     util.NewPubSub(16),
+		orderBooks: make(map[string]*goup.OrderBooks),
+	}
+
+	ch := c.pubsub.Sub("order-book.COB-ETH.1E-7")
+	frames := []string{
+		// updates before the snapshot are ignored
+		`{"h": ["order-book.COB-ETH.1E-7", "1", "u"], "d": {"bids": [["0.0001", "1", "1"]], "asks": []}}`,
+		`{"h": ["order-book.COB-ETH.1E-7", "2", "s"], "d": {"bids": [["0.0001", "2", "10"], ["0.00009", "1", "5"]], "asks": [["0.0002", "1", "3"]]}}`,
+		`{"h": ["order-book.COB-ETH.1E-7", "3", "u"], "d": {"bids": [["0.0001", "-1", "-4"], ["0.00009", "-1", "-5"]], "asks": [["0.00015", "1", "2"]]}}`,
+	}
+
+	go func() {
+		for _, frame := range frames {
+			c.handleWsMsg([]byte(frame))
+		}
+		c.pubsub.Shutdown()
+	}()
+
+	var depths []*goup.Depth
+	for d := range ch {
+		depths = append(depths, d.(*goup.Depth))
+	}
+
+	if len(depths) != 2 {
+		t.Fatalf("got %d depths, want 2", len(depths))
+	}
+
+	d := depths[1]
+	wantBids := goup.DepthRecords{{Price: 0.0001, Amount: 6}}
+	wantAsks := goup.DepthRecords{{Price: 0.00015, Amount: 2}, {Price: 0.0002, Amount: 3}}
+	if len(d.BidList) != len(wantBids) || d.BidList[0] != wantBids[0] {
+		t.Errorf("got bids %+v, want %+v", d.BidList, wantBids)
+	}
+
+	if len(d.AskList) != len(wantAsks) || d.AskList[0] != wantAsks[0] || d.AskList[1] != wantAsks[1] {
+		t.Errorf("got asks %+v, want %+v", d.AskList, wantAsks)
+	}
+
+	if depths[0].Seq != 2 || d.Seq != 3 || d.LocalTs == 0 {
+		t.Errorf("got seq %d and %d, local ts %d", depths[0].Seq, d.Seq, d.LocalTs)
+	}
+
+	// the snapshot delivered first is left untouched
+	if len(depths[0].BidList) != 2 || depths[0].BidList[0].Amount != 10 {
+		t.Errorf("snapshot was modified: %+v", depths[0])
+	}
+}
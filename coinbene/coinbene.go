@@ -9,33 +9,59 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"math"
 	"net/http"
 	"sort"
 	"strings"
 	"time"
 
 	"github.com/jflyup/goup"
+	"github.com/jflyup/goup/poller"
 	"github.com/jflyup/goup/util"
 )
 
-const (
-	baseURL = "https://api.coinbene.com/v1"
-)
+// coinbene has no websocket, streams are emulated by polling
+const pollInterval = 2 * time.Second
+
+var baseURL = "https://api.coinbene.com/v1"
+
+var _ goup.API = (*Client)(nil)
 
 type Client struct {
 	key    string
 	secret string
+	poller *poller.Poller
+	// batchConcurrency bounds the requests in flight of batches
+	batchConcurrency int
+	// maxSlippage caps the emulated market orders, see util.MarketBuy
+	maxSlippage float64
 }
 
 func NewClient(apiKey, secretKey string) *Client {
 	client := &Client{
 		key:    apiKey,
 		secret: secretKey,
+		poller: poller.New(pollInterval),
+
+		batchConcurrency: goup.DefaultBatchConcurrency,
+		maxSlippage:      util.DefaultMaxSlippage,
 	}
 
 	return client
 }
 
+// SetBatchConcurrency sets how many requests PlaceOrders, CancelOrders and
+// CancelAll send at once
+func (c *Client) SetBatchConcurrency(n int) {
+	c.batchConcurrency = n
+}
+
+// SetMaxSlippage sets how far from the best price MarketBuy and MarketSell
+// may go, as a fraction of it
+func (c *Client) SetMaxSlippage(s float64) {
+	c.maxSlippage = s
+}
+
 func (c *Client) httpDo(method, url string, params map[string]interface{}) ([]byte, error) {
 	if params != nil {
 		params["timestamp"] = time.Now().UnixNano() / (int64(time.Millisecond) / int64(time.Nanosecond))
@@ -89,6 +115,11 @@ func (c *Client) httpDo(method, url string, params map[string]interface{}) ([]by
 		return nil, err
 	}
 
+	// errors of the gateway in front of the API come as html
+	if rsp.StatusCode > 399 {
+		return nil, &goup.HttpError{StatusCode: rsp.StatusCode, Reply: string(data)}
+	}
+
 	return data, nil
 }
 
@@ -129,12 +160,61 @@ func (c *Client) LimitSell(amount, price float64, pair goup.CurrencyPair) (*goup
 	return c.placeOrder(amount, price, pair, "sell")
 }
 
+// MarketBuy implements the API interface, emulated with a limit order.
+// amount is in quote currency and price caps the price if positive.
 func (c *Client) MarketBuy(amount, price float64, pair goup.CurrencyPair) (*goup.Order, error) {
-	return nil, errors.New("unsupported")
+	return util.MarketBuy(c, amount, price, c.maxSlippage, pair)
 }
 
+// MarketSell implements the API interface, emulated with a limit order.
+// amount is in base currency and price is the floor if positive.
 func (c *Client) MarketSell(amount, price float64, pair goup.CurrencyPair) (*goup.Order, error) {
-	return nil, errors.New("unsupported")
+	return util.MarketSell(c, amount, price, c.maxSlippage, pair)
+}
+
+// GetOrder implements the API interface
+func (c *Client) GetOrder(orderID string, pair goup.CurrencyPair) (*goup.Order, error) {
+	params := map[string]interface{}{"orderid": orderID}
+	data, err := c.httpDo("POST", baseURL+"/trade/order/info", params)
+	if err != nil {
+		return nil, err
+	}
+
+	rsp := &orderInfoRsp{}
+	if err := json.Unmarshal(data, rsp); err != nil {
+		return nil, err
+	}
+
+	if rsp.Status != "ok" {
+		return nil, errors.New(rsp.Description)
+	}
+
+	o := &goup.Order{
+		OrderID:    orderID,
+		Currency:   pair,
+		Price:      util.ToFloat64(rsp.Order.Price),
+		Amount:     util.ToFloat64(rsp.Order.Orderquantity),
+		DealAmount: util.ToFloat64(rsp.Order.Filledquantity),
+	}
+
+	switch rsp.Order.Orderstatus {
+	case "filled":
+		o.Status = goup.Filled
+	case "canceled", "partialCanceled":
+		o.Status = goup.Canceled
+	case "partialFilled":
+		o.Status = goup.PartialFilled
+	default:
+		o.Status = goup.Submitted
+	}
+
+	if rsp.Order.Type == "buy-limit" || rsp.Order.Type == "buy" {
+		o.Side = goup.Buy
+	} else {
+		o.Side = goup.Sell
+	}
+
+	return o, nil
 }
 
 func (c *Client) CancelOrder(orderID string, pair goup.CurrencyPair) (bool, error) {
@@ -157,6 +237,37 @@ func (c *Client) CancelOrder(orderID string, pair goup.CurrencyPair) (bool, erro
 	return false, errors.New(o.Description)
 }
 
+// PlaceOrders implements the API interface, orders are placed one by one
+func (c *Client) PlaceOrders(reqs []*goup.OrderRequest) ([]*goup.OrderResult, error) {
+	return goup.PlaceEach(c, reqs, c.batchConcurrency), nil
+}
+
+// CancelOrders implements the API interface, orders are canceled one by one
+func (c *Client) CancelOrders(pair goup.CurrencyPair, orderIDs []string) ([]*goup.CancelResult, error) {
+	return goup.CancelEach(c, pair, orderIDs, c.batchConcurrency), nil
+}
+
+// CancelAll implements the API interface
+func (c *Client) CancelAll(pair goup.CurrencyPair) ([]*goup.CancelResult, error) {
+	open, err := c.OpenOrders(pair)
+	if err != nil {
+		return nil, err
+	}
+
+	orderIDs := make([]string, 0, len(open))
+	for _, o := range open {
+		orderIDs = append(orderIDs, o.OrderID)
+	}
+
+	return goup.CancelEach(c, pair, orderIDs, c.batchConcurrency), nil
+}
+
+// ReplaceOrder implements the API interface, coinbene can't amend orders so
+// the order is canceled and placed again
+func (c *Client) ReplaceOrder(orderID string, pair goup.CurrencyPair, price, amount float64) (*goup.Replacement, error) {
+	return goup.CancelReplace(c, orderID, pair, price, amount)
+}
+
 func (c *Client) GetTicker(pair goup.CurrencyPair) (*goup.Ticker, error) {
 	data, err := c.httpDo("GET",
 		fmt.Sprintf("%s/market/ticker?symbol=%s", baseURL, strings.ToLower(pair.String())), nil)
@@ -170,8 +281,91 @@ func (c *Client) GetTicker(pair goup.CurrencyPair) (*goup.Ticker, error) {
 		return nil, err
 	}
 
-	log.Println(rsp)
-	return nil, nil
+	if rsp.Status != "ok" {
+		return nil, errors.New(rsp.Description)
+	}
+	if len(rsp.Ticker) == 0 {
+		return nil, goup.ErrInvalidSymbol
+	}
+
+	t := rsp.Ticker[0]
+	return &goup.Ticker{
+		Last: util.ToFloat64(t.Last),
+		Buy:  util.ToFloat64(t.Bid),
+		Sell: util.ToFloat64(t.Ask),
+		High: util.ToFloat64(t.High),
+		Low:  util.ToFloat64(t.Low),
+		Vol:  util.ToFloat64(t.Vol),
+		Date: uint64(rsp.Timestamp),
+	}, nil
+}
+
+// AllSymbols implements the API interface
+func (c *Client) AllSymbols() ([]goup.CurrencyPair, error) {
+	data, err := c.httpDo("GET", baseURL+"/market/symbol", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	rsp := &symbolsRsp{}
+	if err := json.Unmarshal(data, rsp); err != nil {
+		return nil, err
+	}
+
+	if rsp.Status != "ok" {
+		return nil, errors.New(rsp.Description)
+	}
+
+	var pairs []goup.CurrencyPair
+	for _, s := range rsp.Symbol {
+		pairs = append(pairs, goup.NewCurrencyPair(s.BaseAsset, s.QuoteAsset))
+	}
+
+	return pairs, nil
+}
+
+// GetKlines implements the API interface. coinbene has no klines, they're
+// built from the latest trades, so only the klines those cover are returned
+// and since is ignored.
+func (c *Client) GetKlines(pair goup.CurrencyPair, interval goup.KlineInterval, size, since int) ([]*goup.Kline, error) {
+	trades, err := c.GetTrades(pair, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	klines := buildKlines(pair, interval, trades)
+	if size > 0 && len(klines) > size {
+		klines = klines[len(klines)-size:]
+	}
+
+	return klines, nil
+}
+
+// buildKlines aggregates trades into klines of interval, oldest first
+func buildKlines(pair goup.CurrencyPair, interval goup.KlineInterval, trades []*goup.Trade) []*goup.Kline {
+	sorted := make([]*goup.Trade, len(trades))
+	copy(sorted, trades)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Ts < sorted[j].Ts
+	})
+
+	step := int64(interval) * 60 * 1000
+	var klines []*goup.Kline
+	var k *goup.Kline
+	for _, t := range sorted {
+		if open := t.Ts / step * step; k == nil || k.OpenTime != open {
+			k = &goup.Kline{Pair: pair, OpenTime: open, Open: t.Price, High: t.Price, Low: t.Price}
+			klines = append(klines, k)
+		}
+
+		k.Ts = t.Ts
+		k.Close = t.Price
+		k.High = math.Max(k.High, t.Price)
+		k.Low = math.Min(k.Low, t.Price)
+		k.Vol += t.Amount
+	}
+
+	return klines
 }
 
 // GetDepth implements the API interface
@@ -187,9 +381,10 @@ func (c *Client) GetDepth(pair goup.CurrencyPair, size int) (*goup.Depth, error)
 		return nil, err
 	}
 
-	log.Println(string(data))
 	d := &goup.Depth{
-		Pair: pair,
+		Pair:    pair,
+		Ts:      rsp.Timestamp,
+		LocalTs: util.NowMs(),
 	}
 	for _, bid := range rsp.Orderbook.Bids {
 		d.BidList = append(d.BidList, goup.DepthRecord{
@@ -205,9 +400,78 @@ func (c *Client) GetDepth(pair goup.CurrencyPair, size int) (*goup.Depth, error)
 		})
 	}
 
+	d.Normalize()
+	d.Truncate(size)
 	return d, nil
 }
 
+// GetTrades implements the API interface, coinbene ignores since and
+// returns the latest trades
+func (c *Client) GetTrades(pair goup.CurrencyPair, since int64) ([]*goup.Trade, error) {
+	data, err := c.httpDo("GET",
+		fmt.Sprintf("%s/market/trades?symbol=%s&size=300", baseURL, strings.ToLower(pair.String())), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	rsp := &tradesRsp{}
+	if err := json.Unmarshal(data, rsp); err != nil {
+		return nil, err
+	}
+
+	if rsp.Status != "ok" {
+		return nil, errors.New(rsp.Description)
+	}
+
+	var trades []*goup.Trade
+	for _, t := range rsp.Trades {
+		trades = append(trades, &goup.Trade{
+			Pair:   pair,
+			Tid:    util.ToInt64(t.TradeID),
+			Type:   t.Take,
+			Amount: t.Quantity,
+			Price:  t.Price,
+			Ts:     util.ToInt64(t.Time),
+		})
+	}
+
+	return trades, nil
+}
+
+// WsDepth implements the API interface by polling GetDepth, coinbene can't
+// aggregate so a tick requested by goup.WithTick is regrouped locally
+func (c *Client) WsDepth(pair goup.CurrencyPair, handler func(*goup.Depth), opts ...goup.SubOption) error {
+	cfg := goup.NewSubConfig(opts...)
+	c.poller.Depth(c, pair, poller.DefaultDepthSize, func(d *goup.Depth) {
+		handler(d.Regroup(cfg.Tick))
+	})
+	return nil
+}
+
+// WsTrades implements the API interface by polling GetTrades
+func (c *Client) WsTrades(pair goup.CurrencyPair, handler func([]*goup.Trade), opts ...goup.SubOption) error {
+	c.poller.Trades(c, pair, handler)
+	return nil
+}
+
+// GetOrderHistory implements the API interface, coinbene only lists open
+// orders so goup.ErrUnsupported is returned
+func (c *Client) GetOrderHistory(pair goup.CurrencyPair, currentPage, pageSize int) ([]goup.Order, error) {
+	return nil, goup.ErrUnsupported
+}
+
+// ExchangeName implements the API interface
+func (c *Client) ExchangeName() string {
+	return goup.Coinbene
+}
+
+// WsKlines implements the API interface by polling GetKlines, which builds
+// them from the latest trades
+func (c *Client) WsKlines(pair goup.CurrencyPair, interval goup.KlineInterval, handler func(*goup.Kline), opts ...goup.SubOption) error {
+	c.poller.Klines(c, pair, interval, handler)
+	return nil
+}
+
 func (c *Client) OpenOrders(pair goup.CurrencyPair) ([]*goup.Order, error) {
 	params := map[string]interface{}{"symbol": pair.String()}
 	data, err := c.httpDo("POST", baseURL+"/trade/order/open-orders", params)
@@ -224,6 +488,8 @@ func (c *Client) OpenOrders(pair goup.CurrencyPair) ([]*goup.Order, error) {
 	for _, order := range rsp.Orders.Result {
 		o := &goup.Order{
 			OrderID: order.OrderID,
+			Price:   util.ToFloat64(order.Price),
+			Amount:  util.ToFloat64(order.Orderquantity),
 		}
 		o.Currency = pair
 
@@ -235,9 +501,9 @@ func (c *Client) OpenOrders(pair goup.CurrencyPair) ([]*goup.Order, error) {
 		}
 
 		if order.Type == "buy" {
-			o.Side = goup.BUY
+			o.Side = goup.Buy
 		} else {
-			o.Side = goup.SELL
+			o.Side = goup.Sell
 		}
 
 		orders = append(orders, o)
@@ -276,9 +542,9 @@ func (c *Client) placeOrder(amount, price float64, pair goup.CurrencyPair, side
 	}
 
 	if side == "buy" {
-		order.Side = goup.BUY
+		order.Side = goup.Buy
 	} else if side == "sell" {
-		order.Side = goup.SELL
+		order.Side = goup.Sell
 	}
 
 	return order, nil
@@ -1,14 +1,17 @@
 package coinbene
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/jflyup/goup"
+	"github.com/jflyup/goup/oms"
 )
 
 func TestGetDepth(t *testing.T) {
 	c := NewClient("", "")
-	if _, err := c.GetDepth(0, goup.NewCurrencyPair("ABT", "ETH")); err != nil {
+	if _, err := c.GetDepth(goup.NewCurrencyPair("ABT", "ETH"), 0); err != nil {
 		t.Error(err)
 	}
 }
@@ -46,3 +49,48 @@ func TestCancelOrder(t *testing.T) {
 		t.Log(err)
 	}
 }
+
+func TestBuildKlines(t *testing.T) {
+	pair := goup.NewCurrencyPair("ABT", "ETH")
+	// newest first like the trades endpoint
+	trades := []*goup.Trade{
+		{Price: 4, Amount: 1, Ts: 120000},
+		{Price: 3, Amount: 2, Ts: 61000},
+		{Price: 1, Amount: 1, Ts: 59000},
+		{Price: 2, Amount: 3, Ts: 1000},
+	}
+
+	klines := buildKlines(pair, goup.KlineInterval1Min, trades)
+	want := []goup.Kline{
+		{Pair: pair, Ts: 59000, OpenTime: 0, Open: 2, Close: 1, High: 2, Low: 1, Vol: 4},
+		{Pair: pair, Ts: 61000, OpenTime: 60000, Open: 3, Close: 3, High: 3, Low: 3, Vol: 2},
+		{Pair: pair, Ts: 120000, OpenTime: 120000, Open: 4, Close: 4, High: 4, Low: 4, Vol: 1},
+	}
+	if len(klines) != len(want) {
+		t.Fatalf("got %d klines, want %d", len(klines), len(want))
+	}
+	for i := range want {
+		if *klines[i] != want[i] {
+			t.Errorf("kline %d: got %+v, want %+v", i, klines[i], want[i])
+		}
+	}
+}
+
+// TestServerError checks that a 5xx leaves it unknown whether an order was
+// placed, it may have been accepted before the gateway failed
+func TestServerError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "<html>bad gateway</html>", http.StatusBadGateway)
+	}))
+	defer srv.Close()
+	defer func(url string) { baseURL = url }(baseURL)
+	baseURL = srv.URL
+
+	m := oms.New(0, NewClient("", ""))
+	defer m.Close()
+	m.SetRetries(0)
+	_, err := m.Place(&oms.Request{Exchange: goup.Coinbene, Pair: goup.NewCurrencyPair("ABT", "ETH"), Side: goup.Buy, Price: 0.0012, Amount: 10})
+	if _, ok := err.(*oms.AmbiguousError); !ok {
+		t.Errorf("got %v, want an AmbiguousError", err)
+	}
+}
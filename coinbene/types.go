@@ -39,8 +39,8 @@ type (
 	tradesRsp struct {
 		rsp
 		Symbol string `json:"symbol"`
-		Trades struct {
-			TradeID  string  `json:"tradeId "`
+		Trades []struct {
+			TradeID  string  `json:"tradeId"`
 			Price    float64 `json:"price"`
 			Quantity float64 `json:"quantity"`
 			Take     string  `json:"take"`
@@ -48,11 +48,31 @@ type (
 		} `json:"trades"`
 	}
 
+	symbolsRsp struct {
+		rsp
+		Symbol []struct {
+			Ticker     string `json:"ticker"`
+			BaseAsset  string `json:"baseAsset"`
+			QuoteAsset string `json:"quoteAsset"`
+		} `json:"symbol"`
+	}
+
 	orderRsp struct {
 		rsp
 		Orderid string `json:"orderid"`
 	}
 
+	orderInfoRsp struct {
+		rsp
+		Order struct {
+			Filledquantity string `json:"filledquantity"`
+			Orderquantity  string `json:"orderquantity"`
+			Orderstatus    string `json:"orderstatus"`
+			Price          string `json:"price"`
+			Type           string `json:"type"`
+		} `json:"order"`
+	}
+
 	balanceRsp struct {
 		rsp
 		Orderid string `json:"orderid"`
@@ -0,0 +1,200 @@
+// Package consolidated merges the order books of a pair on several exchanges
+// into a single view of liquidity.
+package consolidated
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jflyup/goup"
+)
+
+// Source is the contribution of an exchange to a price level
+type Source struct {
+	Exchange string
+	// Price is the raw price on the exchange, before fees
+	Price,
+	Amount float64
+}
+
+// Level is a price level of the consolidated book
+type Level struct {
+	// Price is fee-adjusted if fees are set
+	Price,
+	Amount float64
+	Sources []Source
+}
+
+// Snapshot is the consolidated book at a point in time,
+// asks ascending and bids descending.
+type Snapshot struct {
+	Pair goup.CurrencyPair
+	Asks,
+	Bids []Level
+}
+
+// Depth drops the source attribution
+func (s *Snapshot) Depth() *goup.Depth {
+	d := &goup.Depth{
+		Pair:    s.Pair,
+		AskList: make(goup.DepthRecords, 0, len(s.Asks)),
+		BidList: make(goup.DepthRecords, 0, len(s.Bids)),
+	}
+
+	for _, l := range s.Asks {
+		d.AskList = append(d.AskList, goup.DepthRecord{Price: l.Price, Amount: l.Amount})
+	}
+
+	for _, l := range s.Bids {
+		d.BidList = append(d.BidList, goup.DepthRecord{Price: l.Price, Amount: l.Amount})
+	}
+
+	return d
+}
+
+type entry struct {
+	depth   *goup.Depth
+	updated time.Time
+}
+
+// Book merges the latest depth of each exchange, it's safe for concurrent use.
+type Book struct {
+	pair   goup.CurrencyPair
+	maxAge time.Duration
+	lock   sync.Mutex
+	depths map[string]*entry
+	fees   map[string]float64
+	// now is replaced in tests
+	now func() time.Time
+}
+
+// NewBook creates a consolidated book of pair, depth of an exchange not
+// updated within maxAge is evicted, 0 disables eviction.
+func NewBook(pair goup.CurrencyPair, maxAge time.Duration) *Book {
+	return &Book{
+		pair:   pair,
+		maxAge: maxAge,
+		depths: make(map[string]*entry),
+		fees:   make(map[string]float64),
+		now:    time.Now,
+	}
+}
+
+// SetFee sets the taker fee rate of an exchange, e.g. 0.002 for 0.2%.
+// Asks of the exchange are priced up and bids down by the fee, so levels
+// compare by what a taker really pays or gets.
+func (b *Book) SetFee(exchange string, fee float64) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.fees[exchange] = fee
+}
+
+// Update replaces the depth of an exchange
+func (b *Book) Update(exchange string, depth *goup.Depth) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.depths[exchange] = &entry{depth: depth, updated: b.now()}
+}
+
+// Subscribe feeds the book from the websocket depth of each api, the latest
+// depth is all that matters so subscriptions are conflated.
+func (b *Book) Subscribe(apis ...goup.API) error {
+	for _, api := range apis {
+		exchange := api.ExchangeName()
+		if err := api.WsDepth(b.pair, func(d *goup.Depth) {
+			b.Update(exchange, d)
+		}, goup.WithBackpressure(goup.Conflate, nil)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Sources returns the exchanges currently contributing to the book
+func (b *Book) Sources() []string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.evict()
+	var sources []string
+	for exchange := range b.depths {
+		sources = append(sources, exchange)
+	}
+	sort.Strings(sources)
+	return sources
+}
+
+// Snapshot merges the depth of all fresh sources
+func (b *Book) Snapshot() *Snapshot {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.evict()
+	s := &Snapshot{Pair: b.pair}
+	for exchange, e := range b.depths {
+		fee := b.fees[exchange]
+		for _, ask := range e.depth.AskList {
+			s.Asks = append(s.Asks, level(exchange, ask, ask.Price*(1+fee)))
+		}
+
+		for _, bid := range e.depth.BidList {
+			s.Bids = append(s.Bids, level(exchange, bid, bid.Price*(1-fee)))
+		}
+	}
+
+	s.Asks = merge(s.Asks, func(a, b float64) bool { return a < b })
+	s.Bids = merge(s.Bids, func(a, b float64) bool { return a > b })
+	return s
+}
+
+// evict drops stale sources, the caller must hold the write lock
+func (b *Book) evict() {
+	if b.maxAge <= 0 {
+		return
+	}
+
+	now := b.now()
+	for exchange, e := range b.depths {
+		if now.Sub(e.updated) > b.maxAge {
+			delete(b.depths, exchange)
+		}
+	}
+}
+
+func level(exchange string, r goup.DepthRecord, price float64) Level {
+	return Level{
+		Price:   price,
+		Amount:  r.Amount,
+		Sources: []Source{{Exchange: exchange, Price: r.Price, Amount: r.Amount}},
+	}
+}
+
+// merge sorts levels best first and joins the ones of equal price
+func merge(levels []Level, before func(a, b float64) bool) []Level {
+	sort.Slice(levels, func(i, j int) bool {
+		if levels[i].Price == levels[j].Price {
+			return levels[i].Sources[0].Exchange < levels[j].Sources[0].Exchange
+		}
+		return before(levels[i].Price, levels[j].Price)
+	})
+
+	var merged []Level
+	for _, l := range levels {
+		if l.Amount <= 0 {
+			continue
+		}
+
+		if last := len(merged) - 1; last >= 0 && merged[last].Price == l.Price {
+			merged[last].Amount += l.Amount
+			merged[last].Sources = append(merged[last].Sources, l.Sources...)
+		} else {
+			merged = append(merged, l)
+		}
+	}
+
+	return merged
+}
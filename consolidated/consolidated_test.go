@@ -0,0 +1,85 @@
+package consolidated
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/jflyup/goup"
+)
+
+func TestSnapshot(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	b := NewBook(goup.NewCurrencyPair("ETH", "BTC"), time.Minute)
+	b.now = func() time.Time { return now }
+
+	b.Update("gate.io", &goup.Depth{
+		AskList: goup.DepthRecords{{Price: 101, Amount: 1}, {Price: 103, Amount: 2}},
+		BidList: goup.DepthRecords{{Price: 99, Amount: 1}},
+	})
+	b.Update("cobinhood", &goup.Depth{
+		AskList: goup.DepthRecords{{Price: 101, Amount: 3}, {Price: 102, Amount: 1}},
+		BidList: goup.DepthRecords{{Price: 100, Amount: 2}, {Price: 99, Amount: 4}},
+	})
+
+	s := b.Snapshot()
+	wantAsks := []Level{
+		{101, 4, []Source{{"cobinhood", 101, 3}, {"gate.io", 101, 1}}},
+		{102, 1, []Source{{"cobinhood", 102, 1}}},
+		{103, 2, []Source{{"gate.io", 103, 2}}},
+	}
+	wantBids := []Level{
+		{100, 2, []Source{{"cobinhood", 100, 2}}},
+		{99, 5, []Source{{"cobinhood", 99, 4}, {"gate.io", 99, 1}}},
+	}
+	if !equalLevels(s.Asks, wantAsks) {
+		t.Errorf("got asks %+v, want %+v", s.Asks, wantAsks)
+	}
+	if !equalLevels(s.Bids, wantBids) {
+		t.Errorf("got bids %+v, want %+v", s.Bids, wantBids)
+	}
+
+	// a 2% fee on cobinhood makes gate.io the best ask
+	b.SetFee("cobinhood", 0.02)
+	s = b.Snapshot()
+	if s.Asks[0].Price != 101 || s.Asks[0].Sources[0].Exchange != "gate.io" {
+		t.Errorf("fee-adjusted best ask: %+v", s.Asks[0])
+	}
+	if bid := s.Bids[1]; math.Abs(bid.Price-98) > 1e-9 || bid.Sources[0].Exchange != "cobinhood" {
+		t.Errorf("fee-adjusted cobinhood bid: %+v", bid)
+	}
+
+	// gate.io goes silent and is evicted
+	now = now.Add(40 * time.Second)
+	b.Update("cobinhood", &goup.Depth{AskList: goup.DepthRecords{{Price: 102, Amount: 1}}})
+	now = now.Add(30 * time.Second)
+	if sources := b.Sources(); len(sources) != 1 || sources[0] != "cobinhood" {
+		t.Errorf("got sources %v, want [cobinhood]", sources)
+	}
+	if s := b.Snapshot(); len(s.Asks) != 1 || len(s.Bids) != 0 {
+		t.Errorf("stale source not evicted: %+v", s)
+	}
+
+	if d := b.Snapshot().Depth(); len(d.AskList) != 1 || d.AskList[0].Price != 102*1.02 {
+		t.Errorf("depth: %+v", d)
+	}
+}
+
+func equalLevels(a, b []Level) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i].Price != b[i].Price || a[i].Amount != b[i].Amount || len(a[i].Sources) != len(b[i].Sources) {
+			return false
+		}
+		for j := range a[i].Sources {
+			if a[i].Sources[j] != b[i].Sources[j] {
+				return false
+			}
+		}
+	}
+
+	return true
+}
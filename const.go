@@ -40,6 +40,11 @@ func (s OrderStatus) String() string {
 	return status[s]
 }
 
+// Done reports whether the order won't change anymore
+func (s OrderStatus) Done() bool {
+	return s == Filled || s == Canceled || s == Rejected || s == Expired
+}
+
 // KlineInterval is the interval of k line
 type KlineInterval int
 
@@ -57,5 +62,6 @@ const (
 
 const (
 	Cobinhood = "cobinhood.com"
+	Coinbene  = "coinbene.com"
 	Gateio    = "gate.io"
 )
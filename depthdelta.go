@@ -0,0 +1,81 @@
+package goup
+
+// LevelDelta is the change of a price level
+type LevelDelta struct {
+	// Side is Buy for bids and Sell for asks
+	Side  TradeSide
+	Price float64
+	// Amount is the new amount at Price, 0 removes the level
+	Amount float64
+	Seq    uint64
+}
+
+// DepthUpdate is a message of a delta-mode depth subscription. The first one
+// carries the Snapshot to build upon, the following ones only Deltas.
+type DepthUpdate struct {
+	Pair     CurrencyPair
+	Snapshot *Depth
+	Deltas   []LevelDelta
+	// Seq increases by one per update, a gap means updates were lost
+	Seq uint64
+}
+
+// WsDepthDeltas subscribes to depth of pair via api like WsDepth, but hands
+// only the levels changed since the previous update to handler.
+// Deltas are computed against what was delivered, so they stay consistent
+// under dropping or conflating backpressure.
+func WsDepthDeltas(api API, pair CurrencyPair, handler func(*DepthUpdate), opts ...SubOption) error {
+	var prev *Depth
+	var seq uint64
+	return api.WsDepth(pair, func(d *Depth) {
+		if prev == nil {
+			seq++
+			prev = d
+			handler(&DepthUpdate{Pair: pair, Snapshot: d, Seq: seq})
+			return
+		}
+
+		deltas := DiffDepth(prev, d)
+		if len(deltas) == 0 {
+			return
+		}
+
+		seq++
+		for i := range deltas {
+			deltas[i].Seq = seq
+		}
+		prev = d
+		handler(&DepthUpdate{Pair: pair, Deltas: deltas, Seq: seq})
+	}, opts...)
+}
+
+// DiffDepth returns the level changes turning prev into next, asks first.
+// Removed levels come with amount 0.
+func DiffDepth(prev, next *Depth) []LevelDelta {
+	deltas := diffLevels(Sell, prev.AskList, next.AskList)
+	return append(deltas, diffLevels(Buy, prev.BidList, next.BidList)...)
+}
+
+func diffLevels(side TradeSide, prev, next DepthRecords) []LevelDelta {
+	amounts := make(map[float64]float64, len(prev))
+	for _, r := range prev {
+		amounts[r.Price] = r.Amount
+	}
+
+	var deltas []LevelDelta
+	for _, r := range next {
+		if amount, ok := amounts[r.Price]; !ok || amount != r.Amount {
+			deltas = append(deltas, LevelDelta{Side: side, Price: r.Price, Amount: r.Amount})
+		}
+		delete(amounts, r.Price)
+	}
+
+	// what's left has been removed, keep the order of prev
+	for _, r := range prev {
+		if _, ok := amounts[r.Price]; ok {
+			deltas = append(deltas, LevelDelta{Side: side, Price: r.Price})
+		}
+	}
+
+	return deltas
+}
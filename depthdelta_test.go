@@ -0,0 +1,54 @@
+package goup
+
+import "testing"
+
+type depthFeed struct {
+	API
+	depths []*Depth
+}
+
+func (f *depthFeed) WsDepth(pair CurrencyPair, handler func(*Depth), opts ...SubOption) error {
+	for _, d := range f.depths {
+		handler(d)
+	}
+	return nil
+}
+
+func TestWsDepthDeltas(t *testing.T) {
+	feed := &depthFeed{depths: []*Depth{
+		{AskList: DepthRecords{{Price: 101, Amount: 1}, {Price: 102, Amount: 2}}, BidList: DepthRecords{{Price: 99, Amount: 1}}},
+		// unchanged, nothing is emitted
+		{AskList: DepthRecords{{Price: 101, Amount: 1}, {Price: 102, Amount: 2}}, BidList: DepthRecords{{Price: 99, Amount: 1}}},
+		{AskList: DepthRecords{{Price: 102, Amount: 3}}, BidList: DepthRecords{{Price: 100, Amount: 2}, {Price: 99, Amount: 1}}},
+	}}
+
+	var updates []*DepthUpdate
+	if err := WsDepthDeltas(feed, NewCurrencyPair("ETH", "BTC"), func(u *DepthUpdate) {
+		updates = append(updates, u)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(updates) != 2 {
+		t.Fatalf("got %d updates, want 2", len(updates))
+	}
+
+	if updates[0].Snapshot != feed.depths[0] || updates[0].Seq != 1 || len(updates[0].Deltas) != 0 {
+		t.Errorf("first update is not the snapshot: %+v", updates[0])
+	}
+
+	want := []LevelDelta{
+		{Side: Sell, Price: 102, Amount: 3, Seq: 2},
+		{Side: Sell, Price: 101, Amount: 0, Seq: 2},
+		{Side: Buy, Price: 100, Amount: 2, Seq: 2},
+	}
+	got := updates[1].Deltas
+	if updates[1].Snapshot != nil || updates[1].Seq != 2 || len(got) != len(want) {
+		t.Fatalf("got %+v, want deltas %+v", updates[1], want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("delta %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
@@ -12,9 +12,7 @@ import (
 	"net/url"
 	"sort"
 	"strings"
-	"sync"
 
-	"github.com/gorilla/websocket"
 	"github.com/jflyup/goup"
 	"github.com/jflyup/goup/util"
 )
@@ -25,18 +23,24 @@ var (
 	wsBaseURL      = "wss://ws.gateio.io/v3/"
 )
 
+// textPrefix is required by gate.io on the text of an order
+const textPrefix = "t-"
+
+var _ goup.API = (*Client)(nil)
+
 type Client struct {
 	client *http.Client
 	accessKey,
 	secretKey string
-	symbolsInfo  map[goup.CurrencyPair]symbolInfo
-	wsConn       *websocket.Conn
-	subChannels  []interface{}
-	createWsLock sync.Mutex
-	writeLock    sync.Mutex
-	pubsub       *util.PubSub
-	// maintain a local order book
-	orderBook map[goup.CurrencyPair]*goup.Depth
+	symbolsInfo map[goup.CurrencyPair]symbolInfo
+	ws          *util.WsPool
+	pubsub      *util.PubSub
+	// maintain local order books, pairs may be carried by different connections
+	orderBook *goup.OrderBooks
+	// batchConcurrency bounds the orders placed at once by PlaceOrders
+	batchConcurrency int
+	// maxSlippage caps the emulated market orders, see util.MarketBuy
+	maxSlippage float64
 }
 
 func NewClient(accesskey, secretkey string) (*Client, error) {
@@ -45,8 +49,13 @@ func NewClient(accesskey, secretkey string) (*Client, error) {
 		accessKey:   accesskey,
 		secretKey:   secretkey,
 		symbolsInfo: make(map[goup.CurrencyPair]symbolInfo),
-		orderBook:   make(map[goup.CurrencyPair]*goup.Depth),
+		orderBook:   goup.NewOrderBooks(),
+		pubsub:      util.NewPubSub(16),
+
+		batchConcurrency: goup.DefaultBatchConcurrency,
+		maxSlippage:      util.DefaultMaxSlippage,
 	}
+	c.ws = util.NewWsPool(wsBaseURL, c.handleWsMsg)
 
 	if err := c.marketInfo(); err != nil {
 		return nil, err
@@ -55,6 +64,34 @@ func NewClient(accesskey, secretkey string) (*Client, error) {
 	return c, nil
 }
 
+// SetBatchConcurrency sets how many orders PlaceOrders places at once
+func (c *Client) SetBatchConcurrency(n int) {
+	c.batchConcurrency = n
+}
+
+// SetMaxSlippage sets how far from the best price MarketBuy and MarketSell
+// may go, as a fraction of it
+func (c *Client) SetMaxSlippage(s float64) {
+	c.maxSlippage = s
+}
+
+// SetDepthChecksum installs the function verifying local order books against
+// checksums published along with depth updates, gate.io publishes none yet
+func (c *Client) SetDepthChecksum(fn goup.ChecksumFunc) {
+	c.orderBook.SetChecksum(fn)
+}
+
+// DepthResyncs returns how many times a local order book was dropped and
+// re-subscribed because an update failed to apply
+func (c *Client) DepthResyncs() uint64 {
+	return c.orderBook.Resyncs()
+}
+
+// WsPool returns the websocket connections of the client, tune it before subscribing
+func (c *Client) WsPool() *util.WsPool {
+	return c.ws
+}
+
 func (c *Client) httpDo(method string, url string, param string) ([]byte, error) {
 	headers := map[string]string{
 		// gateio asks this header
@@ -113,24 +150,46 @@ func (c *Client) marketInfo() error {
 
 // LimitBuy implements the API interface
 func (c *Client) LimitBuy(amount, price float64, pair goup.CurrencyPair) (*goup.Order, error) {
-	return c.placeOrder(amount, price, pair, "buy")
+	return c.placeOrder(amount, price, pair, "buy", "")
 }
 
 // LimitSell implements the API interface
 func (c *Client) LimitSell(amount, price float64, pair goup.CurrencyPair) (*goup.Order, error) {
-	return c.placeOrder(amount, price, pair, "sell")
+	return c.placeOrder(amount, price, pair, "sell", "")
+}
+
+// PlaceLimitOrder implements goup.ClientOrderPlacer, the client order ID is
+// sent as the text of the order, which is echoed by GetOrder and OpenOrders
+func (c *Client) PlaceLimitOrder(clientOrderID string, side goup.TradeSide, amount, price float64, pair goup.CurrencyPair) (*goup.Order, error) {
+	s := "buy"
+	if side == goup.Sell {
+		s = "sell"
+	}
+
+	order, err := c.placeOrder(amount, price, pair, s, clientOrderID)
+	if err != nil {
+		return nil, err
+	}
+
+	order.ClientOrderID = clientOrderID
+	return order, nil
 }
 
-func (c *Client) MarketBuy(amount, price string, pair goup.CurrencyPair) (*goup.Order, error) {
-	// it's a shame gateio doesn't support market buy/sell!
-	panic("not implement")
+// MarketBuy implements the API interface, amount is in quote currency and
+// price caps the price if positive. It's a shame gateio doesn't support
+// market buy/sell, so it's emulated with a limit order.
+func (c *Client) MarketBuy(amount, price float64, pair goup.CurrencyPair) (*goup.Order, error) {
+	return util.MarketBuy(c, amount, price, c.maxSlippage, pair)
 }
 
-func (c *Client) MarketSell(amount, price string, currency goup.CurrencyPair) (*goup.Order, error) {
-	panic("not implement")
+// MarketSell implements the API interface, amount is in base currency and
+// price is the floor if positive
+func (c *Client) MarketSell(amount, price float64, pair goup.CurrencyPair) (*goup.Order, error) {
+	return util.MarketSell(c, amount, price, c.maxSlippage, pair)
 }
 
-func (c *Client) placeOrder(amount, price float64, pair goup.CurrencyPair, side string) (*goup.Order, error) {
+// placeOrder places a limit order, clientOrderID is optional
+func (c *Client) placeOrder(amount, price float64, pair goup.CurrencyPair, side, clientOrderID string) (*goup.Order, error) {
 	v, ok := c.symbolsInfo[pair]
 	if !ok {
 		return nil, errors.New("unsupported symbol")
@@ -154,6 +213,9 @@ func (c *Client) placeOrder(amount, price float64, pair goup.CurrencyPair, side
 	// use %f to prevent scientific notation
 	params.Set("rate", fmt.Sprintf("%f", price))
 	params.Set("currencyPair", pair.ToSymbol("_"))
+	if clientOrderID != "" {
+		params.Set("text", textPrefix+clientOrderID)
+	}
 	var url string
 	if side == "buy" {
 		url = privateBaseURL + "/buy"
@@ -172,6 +234,10 @@ func (c *Client) placeOrder(amount, price float64, pair goup.CurrencyPair, side
 		return nil, err
 	}
 
+	if o.Result != "true" {
+		return nil, errors.New(o.Message)
+	}
+
 	order := &goup.Order{
 		OrderID:  fmt.Sprint(o.OrderNumber),
 		Currency: pair,
@@ -211,6 +277,93 @@ func (c *Client) CancelOrder(orderID string, pair goup.CurrencyPair) (bool, erro
 	return false, errors.New(r.Message)
 }
 
+// PlaceOrders implements the API interface, gate.io has no batch endpoint
+// for placing so orders are placed one by one
+func (c *Client) PlaceOrders(reqs []*goup.OrderRequest) ([]*goup.OrderResult, error) {
+	return goup.PlaceEach(c, reqs, c.batchConcurrency), nil
+}
+
+// CancelOrders implements the API interface, the batch endpoint succeeds or
+// fails as a whole
+func (c *Client) CancelOrders(pair goup.CurrencyPair, orderIDs []string) ([]*goup.CancelResult, error) {
+	orders := make([]map[string]string, 0, len(orderIDs))
+	for _, id := range orderIDs {
+		orders = append(orders, map[string]string{
+			"orderNumber":  id,
+			"currencyPair": pair.ToSymbol("_"),
+		})
+	}
+
+	data, err := json.Marshal(orders)
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{}
+	params.Set("orders_json", string(data))
+	err = c.cancelBatch("/cancelOrders", params)
+	return cancelResults(orderIDs, err), err
+}
+
+// CancelAll implements the API interface, the open orders of pair are listed
+// beforehand to report them
+func (c *Client) CancelAll(pair goup.CurrencyPair) ([]*goup.CancelResult, error) {
+	open, err := c.OpenOrders(pair)
+	if err != nil {
+		return nil, err
+	}
+
+	var orderIDs []string
+	for _, o := range open {
+		orderIDs = append(orderIDs, o.OrderID)
+	}
+
+	params := url.Values{}
+	// -1 for both sides
+	params.Set("type", "-1")
+	params.Set("currencyPair", pair.ToSymbol("_"))
+	err = c.cancelBatch("/cancelAllOrders", params)
+	return cancelResults(orderIDs, err), err
+}
+
+func (c *Client) cancelBatch(path string, params url.Values) error {
+	data, err := c.httpDo("POST", privateBaseURL+path, params.Encode())
+	if err != nil {
+		return err
+	}
+
+	// result is a bool or a string depending on the endpoint
+	r := struct {
+		Result  interface{}
+		Message string
+	}{}
+
+	if err = json.Unmarshal(data, &r); err != nil {
+		return err
+	}
+
+	if r.Result == true || r.Result == "true" {
+		return nil
+	}
+
+	return errors.New(r.Message)
+}
+
+func cancelResults(orderIDs []string, err error) []*goup.CancelResult {
+	results := make([]*goup.CancelResult, 0, len(orderIDs))
+	for _, id := range orderIDs {
+		results = append(results, &goup.CancelResult{OrderID: id, Err: err})
+	}
+
+	return results
+}
+
+// ReplaceOrder implements the API interface, gate.io can't amend orders so
+// the order is canceled and placed again
+func (c *Client) ReplaceOrder(orderID string, pair goup.CurrencyPair, price, amount float64) (*goup.Replacement, error) {
+	return goup.CancelReplace(c, orderID, pair, price, amount)
+}
+
 func (c *Client) GetOrder(orderID string, pair goup.CurrencyPair) (*goup.Order, error) {
 	params := url.Values{}
 
@@ -232,17 +385,20 @@ func (c *Client) GetOrder(orderID string, pair goup.CurrencyPair) (*goup.Order,
 	}
 
 	order := &goup.Order{
-		OrderID:  orderID,
-		Currency: pair,
+		OrderID:       orderID,
+		Currency:      pair,
+		Price:         util.ToFloat64(o.Order.InitialRate),
+		Amount:        util.ToFloat64(o.Order.InitialAmount),
+		DealAmount:    util.ToFloat64(o.Order.FilledAmount),
+		ClientOrderID: textOrderID(o.Order.Text),
 	}
 
+	// canceled orders may be partially filled, replacing them relies on it
 	switch o.Order.Status {
 	case "open":
 		order.Status = goup.Submitted
-		amount := util.ToFloat64(o.Order.Amount)
-		if amount > 0 {
+		if order.DealAmount > 0 {
 			order.Status = goup.PartialFilled
-			order.DealAmount = amount
 		}
 	case "done":
 		order.Status = goup.Filled
@@ -259,8 +415,11 @@ func (c *Client) GetOrder(orderID string, pair goup.CurrencyPair) (*goup.Order,
 	return order, nil
 }
 
-func (c *Client) OpenOrders() ([]*goup.Order, error) {
-	data, err := c.httpDo("POST", privateBaseURL+"/openOrders", "")
+// OpenOrders implements the API interface
+func (c *Client) OpenOrders(pair goup.CurrencyPair) ([]*goup.Order, error) {
+	params := url.Values{}
+	params.Set("currencyPair", pair.ToSymbol("_"))
+	data, err := c.httpDo("POST", privateBaseURL+"/openOrders", params.Encode())
 	if err != nil {
 		return nil, err
 	}
@@ -273,9 +432,17 @@ func (c *Client) OpenOrders() ([]*goup.Order, error) {
 	var orders []*goup.Order
 	for _, order := range ords.Orders {
 		o := &goup.Order{
-			OrderID: fmt.Sprint(order.OrderNumber),
+			OrderID:       fmt.Sprint(order.OrderNumber),
+			Price:         util.ToFloat64(order.InitialRate),
+			Amount:        util.ToFloat64(order.InitialAmount),
+			CreateTime:    order.Timestamp * 1000,
+			ClientOrderID: textOrderID(order.Text),
 		}
 		o.Currency, _ = goup.ParseSymbol(order.CurrencyPair)
+		// the pair is only a hint to the endpoint
+		if o.Currency != pair {
+			continue
+		}
 
 		o.Status = goup.Submitted
 		o.DealAmount = util.ToFloat64(order.FilledAmount)
@@ -349,25 +516,33 @@ func (c *Client) GetDepth(pair goup.CurrencyPair, size int) (*goup.Depth, error)
 	bids, _ := resp["bids"].([]interface{})
 	asks, _ := resp["asks"].([]interface{})
 
-	dep := new(goup.Depth)
+	dep := &goup.Depth{Pair: pair, LocalTs: util.NowMs()}
 
 	for _, v := range bids {
 		r := v.([]interface{})
-		dep.BidList = append(dep.BidList, goup.DepthRecord{util.ToFloat64(r[0]), util.ToFloat64(r[1])})
+		dep.BidList = append(dep.BidList, goup.DepthRecord{Price: util.ToFloat64(r[0]), Amount: util.ToFloat64(r[1])})
 	}
 
 	for _, v := range asks {
 		r := v.([]interface{})
-		dep.AskList = append(dep.AskList, goup.DepthRecord{util.ToFloat64(r[0]), util.ToFloat64(r[1])})
+		dep.AskList = append(dep.AskList, goup.DepthRecord{Price: util.ToFloat64(r[0]), Amount: util.ToFloat64(r[1])})
 	}
 
-	sort.Sort(sort.Reverse(dep.AskList))
+	// asks come highest first
+	dep.Normalize()
+	dep.Truncate(size)
 
 	return dep, nil
 }
 
+// GetKlines implements the API interface, since is in ms. Klines come oldest
+// first, from since on if positive.
 func (c *Client) GetKlines(pair goup.CurrencyPair, interval goup.KlineInterval, size, since int) ([]*goup.Kline, error) {
 	hour := int(math.Ceil(float64(int(interval)*size) / 60.0))
+	if since > 0 {
+		// the range is counted back from now
+		hour = int(math.Ceil(float64(util.NowMs()-int64(since)) / 3600000))
+	}
 	url := fmt.Sprintf("%s/candlestick2/%s?group_sec=%d&range_hour=%d",
 		marketBaseURL, pair.ToSymbol("_"), int(interval)*60, hour)
 	data, err := c.httpDo("GET", url, "")
@@ -398,36 +573,136 @@ func (c *Client) GetKlines(pair goup.CurrencyPair, interval goup.KlineInterval,
 			Low:      util.ToFloat64(k[4]),
 			Vol:      util.ToFloat64(k[1]),
 		}
+		if kline.OpenTime < int64(since) {
+			continue
+		}
 		klines = append(klines, kline)
 	}
 
+	if since > 0 && size > 0 && len(klines) > size {
+		klines = klines[:size]
+	}
 	return klines, nil
 }
 
-func (c *Client) GetTrades(pair goup.CurrencyPair, since int64) ([]goup.Trade, error) {
-	panic("not implement")
+// GetTrades implements the API interface, since is a trade ID and only the
+// trades after it are returned if positive
+func (c *Client) GetTrades(pair goup.CurrencyPair, since int64) ([]*goup.Trade, error) {
+	uri := fmt.Sprintf("%s/tradeHistory/%s", marketBaseURL, pair.ToSymbol("_"))
+	if since > 0 {
+		uri = fmt.Sprintf("%s/%d", uri, since)
+	}
+
+	data, err := c.httpDo("GET", uri, "")
+	if err != nil {
+		return nil, err
+	}
+
+	rsp := &trades{}
+	if err := json.Unmarshal(data, rsp); err != nil {
+		return nil, err
+	}
+
+	if rsp.Result != "true" {
+		return nil, errors.New(rsp.Message)
+	}
+
+	var trades []*goup.Trade
+	for _, t := range rsp.Data {
+		trades = append(trades, &goup.Trade{
+			Pair:   pair,
+			Tid:    util.ToInt64(t.TradeID),
+			Type:   t.Type,
+			Amount: util.ToFloat64(t.Amount),
+			Price:  util.ToFloat64(t.Rate),
+			Ts:     util.ToInt64(t.Timestamp) * 1000,
+		})
+	}
+
+	return trades, nil
+}
+
+// GetOrderHistory implements the API interface, currentPage starts at 1.
+// gate.io only lists the fills of the account, the orders they belong to
+// are read with GetOrder, newest first. Orders which never filled are
+// missing.
+func (c *Client) GetOrderHistory(pair goup.CurrencyPair, currentPage, pageSize int) ([]goup.Order, error) {
+	params := url.Values{}
+	params.Set("currencyPair", pair.ToSymbol("_"))
+	data, err := c.httpDo("POST", privateBaseURL+"/tradeHistory", params.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	rsp := &fills{}
+	if err := json.Unmarshal(data, rsp); err != nil {
+		return nil, err
+	}
+
+	if rsp.Result != "true" {
+		return nil, errors.New(rsp.Message)
+	}
+
+	// the latest fill of every order
+	latest := make(map[string]int64)
+	for _, t := range rsp.Trades {
+		id := fmt.Sprint(t.OrderNumber)
+		if ts, ok := latest[id]; !ok || t.TimeUnix > ts {
+			latest[id] = t.TimeUnix
+		}
+	}
+
+	var orderIDs []string
+	for id := range latest {
+		orderIDs = append(orderIDs, id)
+	}
+	sort.Slice(orderIDs, func(i, j int) bool {
+		return latest[orderIDs[i]] > latest[orderIDs[j]]
+	})
+
+	if currentPage < 1 {
+		currentPage = 1
+	}
+	start := (currentPage - 1) * pageSize
+	if pageSize <= 0 || start >= len(orderIDs) {
+		return nil, nil
+	}
+	end := start + pageSize
+	if end > len(orderIDs) {
+		end = len(orderIDs)
+	}
+	orderIDs = orderIDs[start:end]
+
+	var orders []goup.Order
+	for _, id := range orderIDs {
+		o, err := c.GetOrder(id, pair)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, *o)
+	}
+
+	return orders, nil
 }
 
 func (c *Client) ExchangeName() string {
 	return goup.Gateio
 }
 
-func (c *Client) WsKlines(pair goup.CurrencyPair, interval goup.KlineInterval, handler func(*goup.Kline)) error {
-	if err := c.createWsConn(); err != nil {
-		return err
-	}
-
-	if err := c.subscribe(map[string]interface{}{
+func (c *Client) WsKlines(pair goup.CurrencyPair, interval goup.KlineInterval, handler func(*goup.Kline), opts ...goup.SubOption) error {
+	topic := strings.Join([]string{"kline.subscribe", pair.ToSymbol("_")}, ".")
+	if err := c.ws.Subscribe(topic, map[string]interface{}{
 		"id":     10,
 		"method": "kline.subscribe",
 		"params": []interface{}{
 			pair.ToSymbol("_"), int(interval) * 60,
 		},
-	}, true); err != nil {
+	}); err != nil {
 		return err
 	}
 
-	ch := c.pubsub.Sub(strings.Join([]string{"kline.subscribe", pair.ToSymbol("_")}, "."))
+	cfg := goup.NewSubConfig(opts...)
+	ch := c.pubsub.SubWithPolicy(cfg.Backpressure, cfg.Dropped, topic)
 	go func() {
 		for {
 			d := (<-ch).(*goup.Kline)
@@ -439,49 +714,47 @@ func (c *Client) WsKlines(pair goup.CurrencyPair, interval goup.KlineInterval, h
 	return nil
 }
 
-func (c *Client) WsDepth(pair goup.CurrencyPair, handler func(*goup.Depth)) error {
-	if err := c.createWsConn(); err != nil {
-		return err
-	}
-
-	if err := c.subscribe(map[string]interface{}{
+func (c *Client) WsDepth(pair goup.CurrencyPair, handler func(*goup.Depth), opts ...goup.SubOption) error {
+	topic := depthTopic(pair)
+	if err := c.ws.Subscribe(topic, map[string]interface{}{
 		"id":     1,
 		"method": "depth.subscribe",
 		"params": []interface{}{
 			pair.ToSymbol("_"), 30, "0.00000001",
 		},
-	}, true); err != nil {
+	}); err != nil {
 		return err
 	}
 
-	ch := c.pubsub.Sub(strings.Join([]string{"depth.subscribe", pair.ToSymbol("_")}, "."))
+	cfg := goup.NewSubConfig(opts...)
+	ch := c.pubsub.SubWithPolicy(cfg.Backpressure, cfg.Dropped, topic)
 	go func() {
 		for {
 			d := (<-ch).(*goup.Depth)
 			//log.Printf("%+v", d)
-			handler(d)
+			// depth.update doesn't tell the interval it was subscribed with,
+			// so a single book is kept at the finest one and regrouped here
+			handler(d.Regroup(cfg.Tick))
 		}
 	}()
 
 	return nil
 }
 
-func (c *Client) WsTrades(pair goup.CurrencyPair, handler func([]*goup.Trade)) error {
-	if err := c.createWsConn(); err != nil {
-		return err
-	}
-
-	if err := c.subscribe(map[string]interface{}{
+func (c *Client) WsTrades(pair goup.CurrencyPair, handler func([]*goup.Trade), opts ...goup.SubOption) error {
+	topic := strings.Join([]string{"trades.subscribe", pair.ToSymbol("_")}, ".")
+	if err := c.ws.Subscribe(topic, map[string]interface{}{
 		"id":     2,
 		"method": "trades.subscribe",
 		"params": []string{
 			pair.ToSymbol("_"),
 		},
-	}, true); err != nil {
+	}); err != nil {
 		return err
 	}
 
-	ch := c.pubsub.Sub(strings.Join([]string{"trades.subscribe", pair.ToSymbol("_")}, "."))
+	cfg := goup.NewSubConfig(opts...)
+	ch := c.pubsub.SubWithPolicy(cfg.Backpressure, cfg.Dropped, topic)
 	go func() {
 		for {
 			d := (<-ch).([]*goup.Trade)
@@ -493,6 +766,16 @@ func (c *Client) WsTrades(pair goup.CurrencyPair, handler func([]*goup.Trade)) e
 	return nil
 }
 
+// textOrderID returns the client order ID carried by the text of an order,
+// texts not set by PlaceLimitOrder are ignored
+func textOrderID(text string) string {
+	if !strings.HasPrefix(text, textPrefix) {
+		return ""
+	}
+
+	return strings.TrimPrefix(text, textPrefix)
+}
+
 // unexported method
 func sign(params, secret string) string {
 	key := []byte(secret)
@@ -501,64 +784,8 @@ func sign(params, secret string) string {
 	return fmt.Sprintf("%x", mac.Sum(nil))
 }
 
-func updateDepth(data []goup.DepthRecord, el goup.DepthRecord, ask bool) []goup.DepthRecord {
-	index := 0
-	if ask {
-		index = sort.Search(len(data), func(i int) bool { return data[i].Price >= el.Price })
-	} else {
-		index = sort.Search(len(data), func(i int) bool { return data[i].Price <= el.Price })
-	}
-
-	if index < len(data) && data[index].Price == el.Price {
-		data[index] = el
-		if el.Amount == 0 {
-			// indices are in range if 0 <= low <= high <= len(a)
-			data = append(data[:index], data[index+1:]...)
-		}
-	} else {
-		data = append(data, goup.DepthRecord{})
-		copy(data[index+1:], data[index:])
-		data[index] = el
-	}
-
-	return data
-}
-
-func (c *Client) createWsConn() error {
-	c.createWsLock.Lock()
-	defer c.createWsLock.Unlock()
-
-	if c.wsConn == nil {
-		var err error
-		if c.wsConn, _, err = websocket.DefaultDialer.Dial(wsBaseURL, nil); err != nil {
-			log.Printf("ERROR\thuobi websocket error: %v", err)
-			return err
-		}
-
-		c.pubsub = util.NewPubSub(16)
-		go c.wsLoop()
-	}
-
-	return nil
-}
-
-func (c *Client) subscribe(subEvent interface{}, keep bool) error {
-	// Applications are responsible for ensuring that
-	// no more than one goroutine calls the write methods concurrently
-	// and that no more than one goroutine calls the read methods concurrently.
-	c.writeLock.Lock()
-	err := c.wsConn.WriteJSON(subEvent)
-	c.writeLock.Unlock()
-	if err != nil {
-		log.Printf("ERROR\twebsocket write error: %v", err)
-		return err
-	}
-
-	if keep {
-		// keep this for re-subscribe when reconnecting
-		c.subChannels = append(c.subChannels, subEvent)
-	}
-	return nil
+func depthTopic(pair goup.CurrencyPair) string {
+	return strings.Join([]string{"depth.subscribe", pair.ToSymbol("_")}, ".")
 }
 
 func parseTrades(data json.RawMessage) ([]*goup.Trade, error) {
@@ -592,16 +819,17 @@ func parseTrades(data json.RawMessage) ([]*goup.Trade, error) {
 func (c *Client) maintainDepth(data json.RawMessage) {
 	// gateio declare an odd json structure, WTF
 	wsNotify := []interface{}{}
-	if err := json.Unmarshal(data, &wsNotify); err != nil {
+	if err := json.Unmarshal(data, &wsNotify); err != nil || len(wsNotify) < 3 {
 		log.Printf("json.Unmarshal error: %v, raw msg: %s", err, string(data))
+		return
 	}
 
 	snapshot := wsNotify[0].(bool)
 	pair, _ := goup.ParseSymbol(wsNotify[2].(string))
 	d := wsNotify[1].(map[string]interface{})
 
-	depth := new(goup.Depth)
-	depth.Pair = pair
+	// depth.update carries neither time nor update ID
+	depth := &goup.Depth{Pair: pair, LocalTs: util.NowMs()}
 	bids, ok := d["bids"]
 	if ok {
 		for _, bid := range bids.([]interface{}) {
@@ -624,77 +852,46 @@ func (c *Client) maintainDepth(data json.RawMessage) {
 		}
 	}
 
-	// maintain a loacl order book
+	// maintain a loacl order book, snapshots published are never modified
+	var snap *goup.Depth
 	if snapshot {
-		c.orderBook[pair] = depth
+		snap = c.orderBook.Reset(depth)
 	} else {
-		log.Printf("update: %+v", depth)
-		if localDepth, ok := c.orderBook[pair]; ok {
-			for _, ask := range depth.AskList {
-				localDepth.AskList = updateDepth(localDepth.AskList, ask, true)
-			}
-
-			for _, bid := range depth.BidList {
-				localDepth.BidList = updateDepth(localDepth.BidList, bid, false)
-			}
-		} else {
+		var err error
+		if snap, err = c.orderBook.Update(depth); err == goup.ErrNoOrderBook {
 			log.Printf("illegal depth data")
 			return
+		} else if err != nil {
+			// the book is dropped until a new snapshot comes
+			log.Printf("ERROR\tlocal order book of %s: %v, resyncing", pair, err)
+			if err := c.ws.Resubscribe(depthTopic(pair)); err != nil {
+				log.Printf("ERROR\tfailed to resync order book: %v", err)
+			}
+			return
 		}
 	}
 
-	c.pubsub.Pub(c.orderBook[pair], strings.Join([]string{"depth.subscribe", depth.Pair.ToSymbol("_")}, "."))
+	c.pubsub.Pub(snap, depthTopic(pair))
 }
 
-func (c *Client) reconnectWs() error {
-	c.createWsLock.Lock()
-	defer c.createWsLock.Unlock()
-	c.wsConn.Close()
-	conn, err := util.ReconnectWs(wsBaseURL)
-	if err != nil {
-		return err
-	}
-	c.wsConn = conn
-
-	// TODO use a set for channels
-	// resubscribe channels
-	for _, sub := range c.subChannels {
-		c.subscribe(sub, false)
-	}
-
-	return nil
-}
-
-func (c *Client) wsLoop() {
+func (c *Client) handleWsMsg(msg []byte) {
 	m := &wsMsg{}
-	for {
-		_, msg, err := c.wsConn.ReadMessage()
-		if err != nil {
-			log.Printf("ERROR\tfailed to read from gateio websocket: %v", err)
-			if err := c.reconnectWs(); err != nil {
-				log.Printf("ERROR\twebsocket reconnect error")
-				return
-			}
-			continue
-		}
-
-		if err := json.Unmarshal(msg, &m); err != nil {
-			log.Printf("json.Unmarshal error: %v, raw msg: %s", err, string(msg))
-			continue
-		}
-
-		switch m.Method {
-		case "kline.subscribe":
-			//c.pubsub.Pub(trades, strings.Join([]string{"kline.subscribe", trades[0].Pair.ToSymbol("_")}, "."))
-		case "depth.update":
-			c.maintainDepth(m.Params)
-		case "trades.update":
-			if trades, err := parseTrades(m.Params); err != nil {
-				log.Printf("failed to parse depth: %v", err)
-			} else {
-				if len(trades) > 0 {
-					c.pubsub.Pub(trades, strings.Join([]string{"trades.subscribe", trades[0].Pair.ToSymbol("_")}, "."))
-				}
+	if err := json.Unmarshal(msg, m); err != nil {
+		log.Printf("json.Unmarshal error: %v, raw msg: %s", err, string(msg))
+		return
+	}
+
+	switch m.Method {
+	case "kline.subscribe":
+		//c.pubsub.Pub(trades, strings.Join([]string{"kline.subscribe", trades[0].Pair.ToSymbol("_")}, "."))
+	case "depth.update":
+		c.maintainDepth(m.Params)
+	case "trades.update":
+		if trades, err := parseTrades(m.Params); err != nil {
+			log.Printf("failed to parse depth: %v", err)
+		} else {
+			if len(trades) > 0 {
+				c.pubsub.Pub(trades, strings.Join([]string{"trades.subscribe", trades[0].Pair.ToSymbol("_")}, "."))
 			}
 		}
 	}
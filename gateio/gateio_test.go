@@ -1,10 +1,15 @@
 package gateio
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/jflyup/goup"
+	"github.com/jflyup/goup/util"
 )
 
 var gate, _ = NewClient("", "")
@@ -42,7 +47,7 @@ func TestAllSymbols(t *testing.T) {
 }
 
 func TestOpenOrders(t *testing.T) {
-	if orders, err := gate.OpenOrders(); err != nil {
+	if orders, err := gate.OpenOrders(goup.NewCurrencyPair("DOCK", "ETH")); err != nil {
 		t.Errorf("error: %v", err)
 	} else {
 		if len(orders) < 2 {
@@ -102,43 +107,85 @@ func TestWsTrades(t *testing.T) {
 	time.Sleep(time.Second * 20)
 }
 
-func TestUpdateDepth(t *testing.T) {
-	asks := []goup.DepthRecord{
-		goup.DepthRecord{Price: 0.00015956, Amount: 11.06957197},
-		goup.DepthRecord{Price: 0.00015957, Amount: 6069.4644},
-		goup.DepthRecord{Price: 0.00015959, Amount: 38.80574195},
-		goup.DepthRecord{Price: 0.00015979, Amount: 31374.8668},
-		goup.DepthRecord{Price: 0.0001598, Amount: 20000},
-		goup.DepthRecord{Price: 0.0001606, Amount: 5000},
-		goup.DepthRecord{Price: 0.00016199, Amount: 2136.71},
+// TestMaintainDepthRace applies updates while a handler reads the published
+// depth, run it with -race.
+func TestMaintainDepthRace(t *testing.T) {
+	c := &Client{
+		orderBook: goup.NewOrderBooks(),
+		pubsub:    util.NewPubSub(16),
+	}
+
+	pair := goup.NewCurrencyPair("LYM", "ETH")
+	ch := c.pubsub.Sub(depthTopic(pair))
+	done := make(chan float64)
+	go func() {
+		var amount float64
+		for d := range ch {
+			depth := d.(*goup.Depth)
+			// hold on to the depth for a while like a slow handler
+			for _, ask := range depth.AskList {
+				amount = ask.Amount
+			}
+		}
+		done <- amount
+	}()
+
+	c.maintainDepth(json.RawMessage(`[true, {"asks": [["0.0001", "1"]], "bids": [["0.00009", "5"]]}, "LYM_ETH"]`))
+	for i := 2; i <= 1000; i++ {
+		c.maintainDepth(json.RawMessage(fmt.Sprintf(`[false, {"asks": [["0.0001", "%d"]]}, "LYM_ETH"]`, i)))
 	}
+	c.pubsub.Shutdown()
 
-	el := goup.DepthRecord{Price: 0.00018955, Amount: 100}
-	updated := updateDepth(asks, el, true)
-	if updated[7] != el {
-		t.Errorf("failed")
+	if amount := <-done; amount != 1000 {
+		t.Errorf("last depth has amount %f, want 1000", amount)
 	}
+}
+
+// TestClientOrderID places an order with a client order ID against a fake
+// gate.io and reads it back
+func TestClientOrderID(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		switch r.URL.Path {
+		case "/buy":
+			if text := r.Form.Get("text"); text != "t-16b1-1" {
+				fmt.Fprintf(w, `{"result": "false", "message": "text %s"}`, text)
+				return
+			}
+			fmt.Fprint(w, `{"result": "true", "orderNumber": 123}`)
+		case "/openOrders":
+			fmt.Fprint(w, `{"result": "true", "orders": [
+				{"orderNumber": 123, "type": "buy", "initialRate": "0.0001", "initialAmount": "10", "currencyPair": "dock_eth", "text": "t-16b1-1"},
+				{"orderNumber": 124, "type": "buy", "initialRate": "0.0001", "initialAmount": "10", "currencyPair": "dock_eth", "text": "apiv2"},
+				{"orderNumber": 125, "type": "sell", "initialRate": "0.1", "initialAmount": "1", "currencyPair": "lym_eth", "text": "t-16b1-2"}]}`)
+		case "/getOrder":
+			fmt.Fprint(w, `{"result": "true", "order": {"status": "open", "type": "buy", "initialRate": "0.0001", "initialAmount": "10", "text": "t-16b1-1"}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	defer func(url string) { privateBaseURL = url }(privateBaseURL)
+	privateBaseURL = srv.URL
 
-	el = goup.DepthRecord{Price: 0.0001598, Amount: 100}
-	updated = updateDepth(asks, el, true)
-	if updated[4] != el {
-		t.Errorf("failed")
+	pair := goup.NewCurrencyPair("DOCK", "ETH")
+	c := &Client{
+		client:      srv.Client(),
+		symbolsInfo: map[goup.CurrencyPair]symbolInfo{pair: {Precision: 8, MinAmount: 0.001}},
 	}
 
-	var bids []goup.DepthRecord
-	for i := len(asks) - 1; i >= 0; i-- {
-		bids = append(bids, asks[i])
+	order, err := c.PlaceLimitOrder("16b1-1", goup.Buy, 10, 0.0001, pair)
+	if err != nil || order.OrderID != "123" || order.ClientOrderID != "16b1-1" {
+		t.Fatalf("got %+v, %v", order, err)
 	}
 
-	el = goup.DepthRecord{Price: 0.0001607, Amount: 100}
-	updated = updateDepth(bids, el, false)
-	if updated[1] != el {
-		t.Errorf("failed")
+	open, err := c.OpenOrders(pair)
+	if err != nil || len(open) != 2 || open[0].ClientOrderID != "16b1-1" || open[1].ClientOrderID != "" {
+		t.Errorf("open orders: got %+v, %v", open, err)
 	}
 
-	el = goup.DepthRecord{Price: 0.00015956, Amount: 0}
-	updated = updateDepth(updated, el, false)
-	if len(updated) != 7 {
-		t.Errorf("failed")
+	if o, err := c.GetOrder("123", pair); err != nil || o.ClientOrderID != "16b1-1" || o.Amount != 10 {
+		t.Errorf("order: got %+v, %v", o, err)
 	}
 }
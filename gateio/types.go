@@ -46,6 +46,8 @@ type (
 			Amount        string
 			InitialRate   string
 			InitialAmount string
+			FilledAmount  string
+			Text          string
 		}
 	}
 
@@ -66,9 +68,36 @@ type (
 			CurrencyPair  string `json:"currencyPair"`
 			Timestamp     int64  `json:"timestamp"`
 			Status        string `json:"status"`
+			Text          string `json:"text"`
 		} `json:"orders"`
 	}
 
+	// trades is the public trade history of a pair
+	trades struct {
+		reply
+		Data []struct {
+			TradeID   string      `json:"tradeID"`
+			Timestamp string      `json:"timestamp"`
+			Type      string      `json:"type"`
+			Rate      interface{} `json:"rate"`
+			Amount    interface{} `json:"amount"`
+		} `json:"data"`
+	}
+
+	// fills are the trades of the account
+	fills struct {
+		reply
+		Trades []struct {
+			TradeID     interface{} `json:"tradeID"`
+			OrderNumber interface{} `json:"orderNumber"`
+			Pair        string      `json:"pair"`
+			Type        string      `json:"type"`
+			Rate        interface{} `json:"rate"`
+			Amount      interface{} `json:"amount"`
+			TimeUnix    int64       `json:"time_unix"`
+		} `json:"trades"`
+	}
+
 	errorMsg struct {
 		Code    int
 		Message string
@@ -9,6 +9,16 @@ import (
 	"strings"
 )
 
+// HttpError is returned when the server replies with a status other than 200
+type HttpError struct {
+	StatusCode int
+	Reply      string
+}
+
+func (e *HttpError) Error() string {
+	return fmt.Sprintf("HttpStatusCode: %d, reply: %s", e.StatusCode, e.Reply)
+}
+
 func NewHttpRequest(client *http.Client, method string, url string, postData string, headers map[string]string) ([]byte, error) {
 	req, _ := http.NewRequest(method, url, strings.NewReader(postData))
 	if headers != nil {
@@ -30,7 +40,7 @@ func NewHttpRequest(client *http.Client, method string, url string, postData str
 	}
 
 	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("HttpStatusCode: %d, reply: %s", resp.StatusCode, string(bodyData))
+		return nil, &HttpError{StatusCode: resp.StatusCode, Reply: string(bodyData)}
 	}
 
 	return bodyData, nil
@@ -2,6 +2,10 @@ package goup
 
 import (
 	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 // Order represents a buy/sell order
@@ -17,6 +21,10 @@ type Order struct {
 	Status     OrderStatus
 	Currency   CurrencyPair
 	Side       TradeSide
+
+	// ClientOrderID is the ID given by the client, empty if the exchange
+	// doesn't support it
+	ClientOrderID string
 }
 
 func (o Order) String() string {
@@ -75,11 +83,151 @@ func (dr DepthRecords) Less(i, j int) bool {
 	return dr[i].Price < dr[j].Price
 }
 
-// Depth is the order book of a trading pair
+// Depth is the order book of a trading pair. Adapters return it in canonical
+// order, best first: asks ascending and bids descending by price, no level
+// twice, no zero amounts.
 type Depth struct {
 	Pair CurrencyPair
 	AskList,
 	BidList DepthRecords
+	// Checksum is published by some exchanges along with deltas,
+	// it covers the book after applying the delta, 0 if absent
+	Checksum uint32
+	// Ts is the exchange time of the book in ms, 0 if not published
+	Ts int64
+	// LocalTs is when the book was received in ms
+	LocalTs int64
+	// Seq is the update ID of the exchange, 0 if not published.
+	// It aligns REST snapshots with websocket deltas.
+	Seq uint64
+}
+
+// Truncate keeps the best size levels of each side, size <= 0 keeps all
+func (d *Depth) Truncate(size int) {
+	if size <= 0 {
+		return
+	}
+
+	if len(d.AskList) > size {
+		d.AskList = d.AskList[:size]
+	}
+
+	if len(d.BidList) > size {
+		d.BidList = d.BidList[:size]
+	}
+}
+
+// Normalize puts the depth in canonical order, merges levels of the same
+// price by summing their amounts and drops empty levels
+func (d *Depth) Normalize() {
+	d.AskList = nonEmpty(d.AskList)
+	d.BidList = nonEmpty(d.BidList)
+	sort.Stable(d.AskList)
+	sort.Stable(sort.Reverse(d.BidList))
+	d.AskList = merged(d.AskList)
+	d.BidList = merged(d.BidList)
+}
+
+// merged sums up adjacent levels of the same price
+func merged(records DepthRecords) DepthRecords {
+	kept := records[:0]
+	for _, r := range records {
+		if n := len(kept); n > 0 && kept[n-1].Price == r.Price {
+			kept[n-1].Amount += r.Amount
+			continue
+		}
+		kept = append(kept, r)
+	}
+
+	return kept
+}
+
+func nonEmpty(records DepthRecords) DepthRecords {
+	kept := records[:0]
+	for _, r := range records {
+		if r.Amount > 0 {
+			kept = append(kept, r)
+		}
+	}
+
+	return kept
+}
+
+// Validate checks that the depth is in canonical order and that the book
+// isn't crossed, i.e. the best bid is below the best ask
+func (d *Depth) Validate() error {
+	if err := validate(d.AskList, "ask", func(a, b float64) bool { return a < b }); err != nil {
+		return err
+	}
+
+	if err := validate(d.BidList, "bid", func(a, b float64) bool { return a > b }); err != nil {
+		return err
+	}
+
+	if len(d.AskList) > 0 && len(d.BidList) > 0 && d.BidList[0].Price >= d.AskList[0].Price {
+		return fmt.Errorf("crossed book: best bid %v >= best ask %v", d.BidList[0].Price, d.AskList[0].Price)
+	}
+
+	return nil
+}
+
+func validate(records DepthRecords, side string, before func(a, b float64) bool) error {
+	for i, r := range records {
+		if r.Amount <= 0 {
+			return fmt.Errorf("%s %v has amount %v", side, r.Price, r.Amount)
+		}
+
+		if i > 0 && !before(records[i-1].Price, r.Price) {
+			return fmt.Errorf("%s %v is out of order after %v", side, r.Price, records[i-1].Price)
+		}
+	}
+
+	return nil
+}
+
+// Regroup buckets the depth into price levels of tick size, asks are rounded
+// up and bids down so that a bucket never looks better than its orders.
+// Levels are expected best first, the result is in the same order.
+func (d *Depth) Regroup(tick float64) *Depth {
+	if tick <= 0 {
+		return d
+	}
+
+	return &Depth{
+		Pair:    d.Pair,
+		AskList: regroup(d.AskList, tick, math.Ceil),
+		BidList: regroup(d.BidList, tick, math.Floor),
+		Ts:      d.Ts,
+		LocalTs: d.LocalTs,
+		Seq:     d.Seq,
+	}
+}
+
+func regroup(records DepthRecords, tick float64, round func(float64) float64) DepthRecords {
+	// prices are rebuilt from the tick multiple and trimmed to the decimals
+	// of tick, so that 3*0.1 gives 0.3 instead of 0.30000000000000004
+	decimals := 0
+	if s := strconv.FormatFloat(tick, 'f', -1, 64); strings.Contains(s, ".") {
+		decimals = len(s) - strings.Index(s, ".") - 1
+	}
+
+	var grouped DepthRecords
+	for _, r := range records {
+		// tolerate float noise of prices lying exactly on a tick
+		n := r.Price / tick
+		if math.Abs(n-math.Round(n)) < 1e-9 {
+			n = math.Round(n)
+		}
+
+		price, _ := strconv.ParseFloat(strconv.FormatFloat(round(n)*tick, 'f', decimals, 64), 64)
+		if last := len(grouped) - 1; last >= 0 && grouped[last].Price == price {
+			grouped[last].Amount += r.Amount
+		} else {
+			grouped = append(grouped, DepthRecord{Price: price, Amount: r.Amount})
+		}
+	}
+
+	return grouped
 }
 
 // Kline is k-line
@@ -0,0 +1,101 @@
+package goup
+
+import "testing"
+
+func TestRegroup(t *testing.T) {
+	d := &Depth{
+		AskList: DepthRecords{{Price: 0.1, Amount: 1}, {Price: 0.11, Amount: 2}, {Price: 0.19, Amount: 3}, {Price: 0.2, Amount: 4}, {Price: 0.21, Amount: 5}},
+		BidList: DepthRecords{{Price: 0.09, Amount: 1}, {Price: 0.081, Amount: 2}, {Price: 0.08, Amount: 3}, {Price: 0.07, Amount: 4}},
+	}
+
+	got := d.Regroup(0.1)
+	wantAsks := DepthRecords{{Price: 0.1, Amount: 1}, {Price: 0.2, Amount: 9}, {Price: 0.3, Amount: 5}}
+	wantBids := DepthRecords{{Price: 0, Amount: 10}}
+	if !equalRecords(got.AskList, wantAsks) || !equalRecords(got.BidList, wantBids) {
+		t.Errorf("Regroup(0.1) = %+v %+v", got.AskList, got.BidList)
+	}
+
+	got = d.Regroup(0.01)
+	wantBids = DepthRecords{{Price: 0.09, Amount: 1}, {Price: 0.08, Amount: 5}, {Price: 0.07, Amount: 4}}
+	if !equalRecords(got.AskList, d.AskList) || !equalRecords(got.BidList, wantBids) {
+		t.Errorf("Regroup(0.01) = %+v %+v", got.AskList, got.BidList)
+	}
+
+	if d.Regroup(0) != d {
+		t.Error("Regroup(0) changed the depth")
+	}
+}
+
+func TestDepthValidate(t *testing.T) {
+	tables := []struct {
+		depth Depth
+		valid bool
+	}{
+		{Depth{AskList: DepthRecords{{Price: 101, Amount: 1}, {Price: 102, Amount: 1}}, BidList: DepthRecords{{Price: 100, Amount: 1}, {Price: 99, Amount: 1}}}, true},
+		{Depth{}, true},
+		// asks descending
+		{Depth{AskList: DepthRecords{{Price: 102, Amount: 1}, {Price: 101, Amount: 1}}}, false},
+		// bids ascending
+		{Depth{BidList: DepthRecords{{Price: 99, Amount: 1}, {Price: 100, Amount: 1}}}, false},
+		// duplicated level
+		{Depth{AskList: DepthRecords{{Price: 101, Amount: 1}, {Price: 101, Amount: 1}}}, false},
+		{Depth{AskList: DepthRecords{{Price: 101, Amount: 0}}}, false},
+		// crossed
+		{Depth{AskList: DepthRecords{{Price: 101, Amount: 1}}, BidList: DepthRecords{{Price: 101, Amount: 1}}}, false},
+	}
+
+	for i, table := range tables {
+		if err := table.depth.Validate(); (err == nil) != table.valid {
+			t.Errorf("%d: Validate() = %v, want valid %v", i, err, table.valid)
+		}
+	}
+
+	// levels of the same price are merged
+	d := &Depth{
+		AskList: DepthRecords{{Price: 103, Amount: 1}, {Price: 101, Amount: 0}, {Price: 102, Amount: 2}, {Price: 103, Amount: 0.5}},
+		BidList: DepthRecords{{Price: 98, Amount: 1}, {Price: 100, Amount: 2}, {Price: 98, Amount: 2}},
+	}
+	d.Normalize()
+	if err := d.Validate(); err != nil {
+		t.Errorf("normalized depth is invalid: %v", err)
+	}
+	if !equalRecords(d.AskList, DepthRecords{{Price: 102, Amount: 2}, {Price: 103, Amount: 1.5}}) ||
+		!equalRecords(d.BidList, DepthRecords{{Price: 100, Amount: 2}, {Price: 98, Amount: 3}}) {
+		t.Errorf("Normalize() = %+v %+v", d.AskList, d.BidList)
+	}
+}
+
+func TestDepthTruncate(t *testing.T) {
+	d := &Depth{
+		AskList: DepthRecords{{Price: 101, Amount: 1}, {Price: 102, Amount: 1}, {Price: 103, Amount: 1}},
+		BidList: DepthRecords{{Price: 100, Amount: 1}},
+		Seq:     7,
+	}
+
+	d.Truncate(0)
+	if len(d.AskList) != 3 {
+		t.Errorf("Truncate(0) dropped levels: %+v", d.AskList)
+	}
+
+	d.Truncate(2)
+	if !equalRecords(d.AskList, DepthRecords{{Price: 101, Amount: 1}, {Price: 102, Amount: 1}}) || len(d.BidList) != 1 {
+		t.Errorf("Truncate(2) = %+v %+v", d.AskList, d.BidList)
+	}
+
+	if g := d.Regroup(1); g.Seq != 7 {
+		t.Errorf("Regroup lost the sequence: %d", g.Seq)
+	}
+}
+
+func equalRecords(a, b DepthRecords) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
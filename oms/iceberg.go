@@ -0,0 +1,164 @@
+package oms
+
+import (
+	"errors"
+	"math"
+	"sync"
+
+	"github.com/jflyup/goup/util"
+)
+
+var ErrInvalidVisible = errors.New("invalid visible amount")
+
+// Iceberg shows only a slice of a large order on the book, the next slice is
+// placed at the same price once the visible one filled. It follows the
+// events of the manager, which needs polling or Update to see the fills.
+type Iceberg struct {
+	m       *Manager
+	req     Request
+	visible float64
+	lock    sync.Mutex
+	// slice is the client order ID of the visible slice, orderID its
+	// exchange order ID once known
+	slice,
+	orderID string
+	// filled is what the finished slices filled
+	filled   float64
+	canceled bool
+	err      error
+	done     chan struct{}
+	once     sync.Once
+}
+
+// Iceberg places req in slices of visible
+func (m *Manager) Iceberg(req *Request, visible float64) (*Iceberg, error) {
+	if visible <= 0 {
+		return nil, ErrInvalidVisible
+	}
+
+	ic := &Iceberg{m: m, req: *req, visible: visible, done: make(chan struct{})}
+	if err := ic.next(); err != nil {
+		return nil, err
+	}
+
+	return ic, nil
+}
+
+// Done is closed once the whole amount filled, the iceberg was canceled or
+// a slice failed
+func (ic *Iceberg) Done() <-chan struct{} {
+	return ic.done
+}
+
+// Err returns why the iceberg stopped early, nil if it filled or was
+// canceled by Cancel
+func (ic *Iceberg) Err() error {
+	ic.lock.Lock()
+	defer ic.lock.Unlock()
+
+	return ic.err
+}
+
+// Filled returns the amount filled so far
+func (ic *Iceberg) Filled() float64 {
+	ic.lock.Lock()
+	filled, orderID := ic.filled, ic.orderID
+	ic.lock.Unlock()
+
+	if r, ok := ic.m.Order(ic.req.Exchange, orderID); ok {
+		filled += r.DealAmount
+	}
+	return filled
+}
+
+// Cancel stops replenishing and cancels the visible slice. A slice still
+// being placed is canceled once the exchange accepted it, Done is closed
+// when it's done.
+func (ic *Iceberg) Cancel() error {
+	ic.lock.Lock()
+	ic.canceled = true
+	slice, orderID := ic.slice, ic.orderID
+	ic.lock.Unlock()
+
+	if slice == "" {
+		ic.finish(nil)
+		return nil
+	}
+
+	// onEvent cancels it on EventNew
+	if orderID == "" {
+		return nil
+	}
+
+	return ic.m.Cancel(ic.req.Exchange, orderID)
+}
+
+// next places the next slice, it must be called without holding lock since
+// the events of the slice may come before placing returns
+func (ic *Iceberg) next() error {
+	ic.lock.Lock()
+	if ic.canceled {
+		ic.lock.Unlock()
+		ic.finish(nil)
+		return nil
+	}
+
+	req := ic.req
+	req.Amount = math.Min(ic.visible, ic.req.Amount-ic.filled)
+	id := util.NewID()
+	ic.slice, ic.orderID = id, ""
+	ic.lock.Unlock()
+
+	ic.m.hook(id, ic.onEvent)
+	if _, err := ic.m.place(&req, id); err != nil {
+		ic.m.hook(id, nil)
+		ic.finish(err)
+		return err
+	}
+
+	return nil
+}
+
+func (ic *Iceberg) onEvent(e *Event) {
+	ic.lock.Lock()
+	if e.Record.ClientOrderID != ic.slice {
+		ic.lock.Unlock()
+		return
+	}
+
+	// Cancel may have come while the slice was being placed
+	pending := ic.canceled && ic.orderID == ""
+	ic.orderID = e.Record.OrderID
+	if e.Type != EventFilled && e.Type != EventCanceled && e.Type != EventRejected {
+		ic.lock.Unlock()
+		if pending {
+			if err := ic.m.Cancel(ic.req.Exchange, e.Record.OrderID); err != nil {
+				ic.finish(err)
+			}
+		}
+		return
+	}
+
+	ic.m.hook(ic.slice, nil)
+	ic.filled += e.Record.DealAmount
+	ic.slice, ic.orderID = "", ""
+	// float residues of the fills don't make a slice
+	more := e.Type == EventFilled && !ic.canceled && ic.req.Amount-ic.filled > ic.req.Amount*1e-9
+	ic.lock.Unlock()
+
+	if !more {
+		ic.finish(e.Err)
+		return
+	}
+
+	ic.next()
+}
+
+func (ic *Iceberg) finish(err error) {
+	ic.once.Do(func() {
+		ic.lock.Lock()
+		ic.err = err
+		ic.lock.Unlock()
+		close(ic.done)
+	})
+}
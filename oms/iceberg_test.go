@@ -0,0 +1,112 @@
+package oms
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jflyup/goup"
+)
+
+func TestIceberg(t *testing.T) {
+	ex := newFakeExchange("fake")
+	m := New(0, ex)
+	defer m.Close()
+
+	ic, err := m.Iceberg(&Request{Exchange: "fake", Pair: pair, Side: goup.Sell, Price: 2, Amount: 5}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// slices of 2, 2 and 1 at the same price, only one open at a time
+	for i, amount := range []float64{2, 2, 1} {
+		open := m.OpenOrders(pair, "")
+		if len(open) != 1 || open[0].Amount != amount || open[0].Price != 2 {
+			t.Fatalf("slice %d: open orders %+v", i, open)
+		}
+
+		ex.fill(open[0].OrderID, amount/2)
+		m.Refresh()
+		if filled := ic.Filled(); filled != float64(i)*2+amount/2 {
+			t.Errorf("slice %d: filled %v", i, filled)
+		}
+
+		ex.fill(open[0].OrderID, amount/2)
+		m.Refresh()
+	}
+
+	select {
+	case <-ic.Done():
+	case <-time.After(time.Second):
+		t.Fatal("iceberg not done")
+	}
+	if ic.Filled() != 5 || ic.Err() != nil || ex.placed() != 3 || len(m.OpenOrders(pair, "")) != 0 {
+		t.Errorf("filled %v, err %v, %d placed", ic.Filled(), ic.Err(), ex.placed())
+	}
+
+	// canceling stops replenishing
+	ic, err = m.Iceberg(&Request{Exchange: "fake", Pair: pair, Side: goup.Buy, Price: 1, Amount: 5}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	open := m.OpenOrders(pair, "")
+	ex.fill(open[0].OrderID, 1)
+	if err := ic.Cancel(); err != nil {
+		t.Fatal(err)
+	}
+
+	<-ic.Done()
+	if ic.Filled() != 1 || ex.placed() != 4 || len(m.OpenOrders(pair, "")) != 0 {
+		t.Errorf("canceled: filled %v, %d placed", ic.Filled(), ex.placed())
+	}
+
+	if _, err := m.Iceberg(&Request{Exchange: "fake", Amount: 1}, 0); err != ErrInvalidVisible {
+		t.Errorf("got %v, want ErrInvalidVisible", err)
+	}
+}
+
+// TestIcebergCancelPlacing cancels while the next slice is being placed, the
+// slice is canceled once placed and the iceberg is done only then
+func TestIcebergCancelPlacing(t *testing.T) {
+	ex := newFakeExchange("fake")
+	m := New(0, ex)
+	defer m.Close()
+
+	ic, err := m.Iceberg(&Request{Exchange: "fake", Pair: pair, Side: goup.Sell, Price: 2, Amount: 5}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block := make(chan struct{})
+	ex.lock.Lock()
+	ex.block = block
+	ex.lock.Unlock()
+
+	open := m.OpenOrders(pair, "")
+	ex.fill(open[0].OrderID, 2)
+	refreshed := make(chan struct{})
+	go func() {
+		m.Refresh()
+		close(refreshed)
+	}()
+
+	<-block
+	if err := ic.Cancel(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ic.Done():
+		t.Fatal("done while the slice is being placed")
+	default:
+	}
+	block <- struct{}{}
+
+	select {
+	case <-ic.Done():
+	case <-time.After(time.Second):
+		t.Fatal("iceberg not done")
+	}
+	<-refreshed
+	if ic.Filled() != 2 || ic.Err() != nil || ex.placed() != 2 || len(m.OpenOrders(pair, "")) != 0 {
+		t.Errorf("filled %v, err %v, %d placed, open %+v", ic.Filled(), ic.Err(), ex.placed(), m.OpenOrders(pair, ""))
+	}
+}
@@ -0,0 +1,188 @@
+package oms
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/jflyup/goup/util"
+)
+
+type journalOp string
+
+const (
+	// opIntent is written before an order is sent to the exchange
+	opIntent journalOp = "intent"
+	// opPlaced is written once the exchange returned an order ID
+	opPlaced journalOp = "placed"
+	// opDone is written when an order is finished
+	opDone journalOp = "done"
+	// opAbandon drops an intent which never became an order
+	opAbandon journalOp = "abandon"
+)
+
+type journalEntry struct {
+	Op      journalOp `json:"op"`
+	Time    int64     `json:"time"`
+	ID      string    `json:"id,omitempty"`
+	Request *Request  `json:"request,omitempty"`
+	Record  *Record   `json:"record,omitempty"`
+}
+
+// intent is a request which may not have become an order yet
+type intent struct {
+	Request
+	// Time is when the intent was first written, in ms
+	Time int64
+}
+
+// Journal persists order intents and the exchange order IDs they became,
+// so a restarted process knows which orders it owns. It's an append-only
+// file of JSON lines, synced after every write and compacted when opened.
+type Journal struct {
+	lock    sync.Mutex
+	path    string
+	f       *os.File
+	enc     *json.Encoder
+	intents map[string]*intent
+	orders  map[string]*Record
+}
+
+// OpenJournal opens or creates the journal at path
+func OpenJournal(path string) (*Journal, error) {
+	j := &Journal{
+		path:    path,
+		intents: make(map[string]*intent),
+		orders:  make(map[string]*Record),
+	}
+
+	f, err := os.Open(path)
+	if err == nil {
+		j.replay(f)
+		f.Close()
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if err := j.compact(); err != nil {
+		return nil, err
+	}
+
+	return j, nil
+}
+
+// Close closes the journal file
+func (j *Journal) Close() error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	return j.f.Close()
+}
+
+// replay rebuilds the state from r, a torn entry at the end left by a crash
+// ends the replay
+func (j *Journal) replay(r io.Reader) {
+	dec := json.NewDecoder(r)
+	for {
+		var e journalEntry
+		if err := dec.Decode(&e); err != nil {
+			if err != io.EOF {
+				log.Printf("ERROR\tjournal %s is truncated: %v", j.path, err)
+			}
+			return
+		}
+		j.apply(&e)
+	}
+}
+
+func (j *Journal) apply(e *journalEntry) {
+	switch e.Op {
+	case opIntent:
+		j.intents[e.ID] = &intent{Request: *e.Request, Time: e.Time}
+	case opPlaced:
+		delete(j.intents, e.ID)
+		j.orders[key(e.Record.Exchange, e.Record.OrderID)] = e.Record
+	case opDone:
+		delete(j.orders, key(e.Record.Exchange, e.Record.OrderID))
+	case opAbandon:
+		delete(j.intents, e.ID)
+	}
+}
+
+// compact rewrites the journal with only the pending intents and orders,
+// the new file replaces the old one atomically
+func (j *Journal) compact() error {
+	tmp := j.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(f)
+	now := util.NowMs()
+	for id, in := range j.intents {
+		// the time of an intent tells which orders may be it
+		if err := enc.Encode(&journalEntry{Op: opIntent, Time: in.Time, ID: id, Request: &in.Request}); err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	for _, r := range j.orders {
+		if err := enc.Encode(&journalEntry{Op: opPlaced, Time: now, Record: r}); err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	f.Close()
+
+	if err := os.Rename(tmp, j.path); err != nil {
+		return err
+	}
+
+	if j.f, err = os.OpenFile(j.path, os.O_APPEND|os.O_WRONLY, 0600); err != nil {
+		return err
+	}
+	j.enc = json.NewEncoder(j.f)
+	return nil
+}
+
+func (j *Journal) write(e *journalEntry) error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	e.Time = util.NowMs()
+	j.apply(e)
+	if err := j.enc.Encode(e); err != nil {
+		return err
+	}
+
+	return j.f.Sync()
+}
+
+// pending returns copies of the intents not known to be placed and of the
+// orders not known to be done
+func (j *Journal) pending() (map[string]intent, []Record) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	intents := make(map[string]intent, len(j.intents))
+	for id, in := range j.intents {
+		intents[id] = *in
+	}
+
+	records := make([]Record, 0, len(j.orders))
+	for _, r := range j.orders {
+		records = append(records, *r)
+	}
+	sortRecords(records)
+
+	return intents, records
+}
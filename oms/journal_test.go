@@ -0,0 +1,209 @@
+package oms
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jflyup/goup"
+)
+
+func TestReconcile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "journal")
+
+	ex := newFakeExchange("fake")
+	j, err := OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := New(0, ex)
+	m.SetJournal(j)
+
+	filled, _ := m.Place(&Request{Exchange: "fake", Strategy: "grid", Pair: pair, Side: goup.Buy, Price: 1, Amount: 1})
+	open, _ := m.Place(&Request{Exchange: "fake", Strategy: "grid", Pair: pair, Side: goup.Buy, Price: 2, Amount: 1})
+	canceled, _ := m.Place(&Request{Exchange: "fake", Strategy: "grid", Pair: pair, Side: goup.Sell, Price: 3, Amount: 1})
+
+	// an order placed but its response lost, and one which never left
+	landed := &Request{Exchange: "fake", Strategy: "arb", Pair: pair, Side: goup.Sell, Price: 4, Amount: 2}
+	j.write(&journalEntry{Op: opIntent, ID: "landed", Request: landed})
+	ex.LimitSell(landed.Amount, landed.Price, landed.Pair)
+	j.write(&journalEntry{Op: opIntent, ID: "lost", Request: &Request{Exchange: "fake", Pair: pair, Price: 5, Amount: 1}})
+
+	// placed by someone else
+	orphan, _ := ex.LimitBuy(1, 0.5, pair)
+
+	m.Close()
+	j.Close()
+
+	// what happens while the process is down
+	ex.fill(filled.OrderID, 1)
+	ex.CancelOrder(canceled.OrderID, pair)
+
+	// the crash tore the last entry
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	f.WriteString(`{"op":"placed","rec`)
+	f.Close()
+
+	if j, err = OpenJournal(path); err != nil {
+		t.Fatal(err)
+	}
+	m = New(0, ex)
+	m.SetJournal(j)
+	events := collect(m)
+
+	rec, err := m.Reconcile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rec.Adopted) != 2 || rec.Adopted[0].OrderID != open.OrderID || rec.Adopted[1].Strategy != "arb" {
+		t.Errorf("adopted: %+v", rec.Adopted)
+	}
+	if len(rec.Filled) != 1 || rec.Filled[0].OrderID != filled.OrderID || rec.Filled[0].Strategy != "grid" {
+		t.Errorf("filled: %+v", rec.Filled)
+	}
+	if len(rec.Closed) != 1 || rec.Closed[0].OrderID != canceled.OrderID {
+		t.Errorf("closed: %+v", rec.Closed)
+	}
+	if len(rec.Orphans) != 1 || rec.Orphans[0].OrderID != orphan.OrderID {
+		t.Errorf("orphans: %+v", rec.Orphans)
+	}
+	if len(rec.Unresolved) != 1 || rec.Unresolved[0].Price != 5 {
+		t.Errorf("unresolved: %+v", rec.Unresolved)
+	}
+
+	// the fill missed while down is reported like any other, along with
+	// a New event per order and the cancellation
+	var types []EventType
+	for i := 0; i < 6; i++ {
+		types = append(types, (<-events).Type)
+	}
+	fills := 0
+	for _, typ := range types {
+		if typ == EventFilled {
+			fills++
+		}
+	}
+	if fills != 1 {
+		t.Errorf("got events %v, want one fill", types)
+	}
+
+	if open := m.OpenOrders(pair, ""); len(open) != 2 {
+		t.Errorf("got %d open orders, want 2", len(open))
+	}
+
+	m.Close()
+	j.Close()
+
+	// only the open orders are left in the journal
+	if j, err = OpenJournal(path); err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	intents, records := j.pending()
+	if len(intents) != 0 || len(records) != 2 {
+		t.Errorf("pending after reconciliation: %v %+v", intents, records)
+	}
+}
+
+// TestReconcileHistory finds an intent which filled while the process was
+// down, and tracks nothing when a lookup fails
+func TestReconcileHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	j, err := OpenJournal(filepath.Join(dir, "journal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	ex := newFakeExchange("fake")
+	open, _ := ex.LimitBuy(1, 2, pair)
+	j.write(&journalEntry{Op: opPlaced, Record: &Record{Order: *open, Exchange: "fake", Strategy: "grid"}})
+	req := &Request{Exchange: "fake", Strategy: "arb", Pair: pair, Side: goup.Sell, Price: 4, Amount: 2}
+	j.write(&journalEntry{Op: opIntent, ID: "landed", Request: req})
+	landed, _ := ex.LimitSell(req.Amount, req.Price, req.Pair)
+	ex.fill(landed.OrderID, 2)
+
+	m := New(0, historyDown{ex})
+	defer m.Close()
+	m.SetJournal(j)
+	if _, err := m.Reconcile(); err == nil {
+		t.Fatal("reconciled without history")
+	}
+	if open := m.OpenOrders(pair, ""); len(open) != 0 {
+		t.Errorf("tracked %+v after a failed lookup", open)
+	}
+
+	m2 := New(0, ex)
+	defer m2.Close()
+	m2.SetJournal(j)
+	rec, err := m2.Reconcile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rec.Filled) != 1 || rec.Filled[0].OrderID != landed.OrderID || rec.Filled[0].Strategy != "arb" ||
+		rec.Filled[0].ClientOrderID != "landed" {
+		t.Errorf("filled: %+v", rec.Filled)
+	}
+	if len(rec.Adopted) != 1 || rec.Adopted[0].OrderID != open.OrderID || len(rec.Unresolved) != 0 {
+		t.Errorf("got %+v", rec)
+	}
+}
+
+// TestReconcileNoHistory keeps the intents an exchange without history can't
+// rule out, without failing the other exchanges
+func TestReconcileNoHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "journal")
+
+	j, err := OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ex := newFakeExchange("fake")
+	open, _ := ex.LimitBuy(1, 2, pair)
+	j.write(&journalEntry{Op: opPlaced, Record: &Record{Order: *open, Exchange: "fake"}})
+	req := &Request{Exchange: "nohist", Pair: pair, Side: goup.Sell, Price: 4, Amount: 2}
+	j.write(&journalEntry{Op: opIntent, ID: "gone", Request: req})
+
+	m := New(0, ex, noHistory{newFakeExchange("nohist")})
+	m.SetJournal(j)
+	rec, err := m.Reconcile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rec.Adopted) != 1 || rec.Adopted[0].OrderID != open.OrderID {
+		t.Errorf("adopted: %+v", rec.Adopted)
+	}
+	if len(rec.Pending) != 1 || rec.Pending[0].Price != 4 || len(rec.Unresolved) != 0 {
+		t.Errorf("pending %+v, unresolved %+v", rec.Pending, rec.Unresolved)
+	}
+	m.Close()
+	j.Close()
+
+	if j, err = OpenJournal(path); err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	if intents, _ := j.pending(); len(intents) != 1 {
+		t.Errorf("intents after reconciliation: %v", intents)
+	}
+}
@@ -0,0 +1,207 @@
+package oms
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jflyup/goup/util"
+)
+
+// OCO is a pair of orders where one cancels the other: once a leg fills,
+// even partially, or is canceled, the other leg is canceled. It follows the
+// events of the manager, which needs polling or Update to see the fills.
+type OCO struct {
+	m    *Manager
+	lock sync.Mutex
+	// ids are the client order IDs of the legs
+	ids  [2]string
+	legs [2]Record
+	// placed tells which legs exist on the exchange
+	placed [2]bool
+	// resolved is set once a leg finished or filled, canceling the other
+	resolved bool
+	filled   int
+	err      error
+	done     chan struct{}
+	once     sync.Once
+}
+
+// OCO places a and b as a one-cancels-other pair, b isn't placed if a fills
+// at once. If b fails, a is canceled and the pair is returned done along with
+// the error, Legs tell how a ended.
+func (m *Manager) OCO(a, b *Request) (*OCO, error) {
+	o := &OCO{m: m, ids: [2]string{util.NewID(), util.NewID()}, filled: -1, done: make(chan struct{})}
+	for i, req := range []*Request{a, b} {
+		o.lock.Lock()
+		resolved := o.resolved
+		o.lock.Unlock()
+		if resolved {
+			break
+		}
+
+		m.hook(o.ids[i], o.onEvent)
+		if err := o.place(req, i); err != nil {
+			if i == 0 {
+				m.hook(o.ids[0], nil)
+				return nil, err
+			}
+
+			o.lock.Lock()
+			o.resolved = true
+			o.lock.Unlock()
+			if err := o.cancel(0); err != nil {
+				log.Printf("ERROR\tfailed to cancel OCO leg %s: %v", o.ids[0], err)
+			}
+			o.finish()
+			return o, err
+		}
+	}
+
+	o.check()
+	return o, nil
+}
+
+// place places leg i, after an ambiguous failure it's looked up once more
+// since a leg live but untracked would escape the pair
+func (o *OCO) place(req *Request, i int) error {
+	since := time.Now().Add(-clockSkew)
+	_, err := o.m.place(req, o.ids[i])
+	if _, ok := err.(*AmbiguousError); !ok {
+		return err
+	}
+
+	api, apiErr := o.m.API(req.Exchange)
+	if apiErr != nil {
+		return err
+	}
+
+	order, found, lookupErr := o.m.locate(api, req, o.ids[i], since)
+	if lookupErr != nil || !found {
+		return err
+	}
+
+	o.m.placed(req, o.ids[i], order)
+	return nil
+}
+
+// Done is closed once neither leg is open
+func (o *OCO) Done() <-chan struct{} {
+	return o.done
+}
+
+// Filled returns the index of the leg which filled, -1 if none did
+func (o *OCO) Filled() int {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	return o.filled
+}
+
+// Legs returns the latest state of both legs
+func (o *OCO) Legs() [2]Record {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	return o.legs
+}
+
+// Err returns why canceling a leg failed, e.g. both legs filled at once
+func (o *OCO) Err() error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	return o.err
+}
+
+// Cancel cancels both legs
+func (o *OCO) Cancel() error {
+	o.lock.Lock()
+	o.resolved = true
+	o.lock.Unlock()
+
+	err0 := o.cancel(0)
+	if err := o.cancel(1); err != nil {
+		return err
+	}
+	return err0
+}
+
+func (o *OCO) onEvent(e *Event) {
+	i := 0
+	if e.Record.ClientOrderID == o.ids[1] {
+		i = 1
+	}
+
+	o.lock.Lock()
+	o.legs[i] = e.Record
+	o.placed[i] = e.Type != EventRejected
+	fired := !o.resolved && (e.Record.DealAmount > 0 || e.Record.Status.Done())
+	if fired {
+		o.resolved = true
+		if e.Record.DealAmount > 0 {
+			o.filled = i
+		}
+	}
+	o.lock.Unlock()
+
+	if fired {
+		if err := o.cancel(1 - i); err != nil {
+			log.Printf("ERROR\tfailed to cancel OCO leg %s: %v", o.ids[1-i], err)
+		}
+	}
+
+	o.check()
+}
+
+// cancel cancels leg i if it's open
+func (o *OCO) cancel(i int) error {
+	o.lock.Lock()
+	open := o.placed[i] && !o.legs[i].Status.Done()
+	leg := o.legs[i]
+	o.lock.Unlock()
+
+	if !open {
+		return nil
+	}
+
+	err := o.m.Cancel(leg.Exchange, leg.OrderID)
+	if err == ErrUnknownOrder {
+		// it finished meanwhile, its events tell how
+		return nil
+	}
+
+	if err != nil {
+		o.lock.Lock()
+		o.err = err
+		o.lock.Unlock()
+	}
+	return err
+}
+
+// check finishes the pair once no leg is open
+func (o *OCO) check() {
+	o.lock.Lock()
+	for i := range o.legs {
+		if o.placed[i] && !o.legs[i].Status.Done() {
+			o.lock.Unlock()
+			return
+		}
+	}
+	resolved := o.resolved
+	o.lock.Unlock()
+
+	if !resolved {
+		return
+	}
+
+	o.finish()
+}
+
+func (o *OCO) finish() {
+	o.once.Do(func() {
+		o.m.hook(o.ids[0], nil)
+		o.m.hook(o.ids[1], nil)
+		close(o.done)
+	})
+}
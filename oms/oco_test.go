@@ -0,0 +1,131 @@
+package oms
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jflyup/goup"
+)
+
+func TestOCO(t *testing.T) {
+	ex := newFakeExchange("fake")
+	m := New(0, ex)
+	defer m.Close()
+
+	takeProfit := &Request{Exchange: "fake", Pair: pair, Side: goup.Sell, Price: 3, Amount: 1}
+	reentry := &Request{Exchange: "fake", Pair: pair, Side: goup.Buy, Price: 1, Amount: 1}
+	o, err := m.OCO(takeProfit, reentry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a partial fill of the first leg cancels the second
+	legs := o.Legs()
+	ex.fill(legs[0].OrderID, 0.5)
+	m.Refresh()
+
+	legs = o.Legs()
+	if o.Filled() != 0 || legs[1].Status != goup.Canceled {
+		t.Errorf("filled leg %d, legs %+v", o.Filled(), legs)
+	}
+
+	select {
+	case <-o.Done():
+		t.Fatal("done while the first leg is open")
+	default:
+	}
+
+	ex.fill(legs[0].OrderID, 0.5)
+	m.Refresh()
+	<-o.Done()
+	if legs = o.Legs(); legs[0].Status != goup.Filled || o.Err() != nil {
+		t.Errorf("legs %+v, err %v", legs, o.Err())
+	}
+
+	// canceling one leg outside cancels the other
+	o, err = m.OCO(takeProfit, reentry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Cancel("fake", o.Legs()[1].OrderID); err != nil {
+		t.Fatal(err)
+	}
+
+	<-o.Done()
+	if legs = o.Legs(); o.Filled() != -1 || legs[0].Status != goup.Canceled || len(m.OpenOrders(pair, "")) != 0 {
+		t.Errorf("filled leg %d, legs %+v", o.Filled(), legs)
+	}
+}
+
+// buyFails answers buys with err, after placing them if landed, and fails
+// the next openFails lookups of open orders
+type buyFails struct {
+	*fakeExchange
+	err       error
+	landed    bool
+	openFails int
+}
+
+func (b *buyFails) LimitBuy(amount, price float64, pair goup.CurrencyPair) (*goup.Order, error) {
+	if b.landed {
+		b.fakeExchange.LimitBuy(amount, price, pair)
+	}
+	return nil, b.err
+}
+
+func (b *buyFails) OpenOrders(pair goup.CurrencyPair) ([]*goup.Order, error) {
+	if b.openFails > 0 {
+		b.openFails--
+		return nil, errors.New("service unavailable")
+	}
+	return b.fakeExchange.OpenOrders(pair)
+}
+
+func TestOCOFailure(t *testing.T) {
+	takeProfit := &Request{Exchange: "fake", Pair: pair, Side: goup.Sell, Price: 3, Amount: 1}
+	reentry := &Request{Exchange: "fake", Pair: pair, Side: goup.Buy, Price: 1, Amount: 1}
+
+	for _, table := range []struct {
+		name      string
+		err       error
+		landed    bool
+		openFails int
+		// live tells whether the pair goes on with both legs
+		live bool
+	}{
+		{"rejected", goup.ErrInsufficientBalance, false, 0, false},
+		// the second lookup finds the leg
+		{"found", timeoutError{}, true, 1, true},
+		{"lost", timeoutError{}, true, 2, false},
+	} {
+		ex := &buyFails{fakeExchange: newFakeExchange("fake"), err: table.err, landed: table.landed, openFails: table.openFails}
+		m := New(0, ex)
+		m.SetRetries(0)
+
+		o, err := m.OCO(takeProfit, reentry)
+		if table.live {
+			if err != nil || len(m.OpenOrders(pair, "")) != 2 {
+				t.Errorf("%s: got %v, open %+v", table.name, err, m.OpenOrders(pair, ""))
+			}
+			m.Close()
+			continue
+		}
+
+		if err == nil || o == nil {
+			t.Fatalf("%s: got %v, %v", table.name, o, err)
+		}
+		select {
+		case <-o.Done():
+		default:
+			t.Errorf("%s: not done", table.name)
+		}
+
+		m.lock.Lock()
+		hooks := len(m.hooks)
+		m.lock.Unlock()
+		if legs := o.Legs(); legs[0].Status != goup.Canceled || hooks != 0 {
+			t.Errorf("%s: legs %+v, %d hooks left", table.name, legs, hooks)
+		}
+		m.Close()
+	}
+}
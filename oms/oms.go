@@ -0,0 +1,441 @@
+// Package oms tracks the lifecycle of orders placed through goup.API and
+// turns status changes into events.
+package oms
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jflyup/goup"
+	"github.com/jflyup/goup/util"
+)
+
+var (
+	ErrUnknownExchange = errors.New("unknown exchange")
+	ErrUnknownOrder    = errors.New("unknown order")
+	ErrNoJournal       = errors.New("no journal")
+)
+
+// EventType is a transition in the lifecycle of an order
+type EventType int
+
+const (
+	// EventNew is emitted once the exchange accepted the order
+	EventNew EventType = iota
+	EventPartialFill
+	EventFilled
+	// EventCanceled is emitted for canceled and expired orders
+	EventCanceled
+	// EventRejected is emitted when placing fails or the exchange rejects the order
+	EventRejected
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventNew:
+		return "new"
+	case EventPartialFill:
+		return "partial fill"
+	case EventFilled:
+		return "filled"
+	case EventCanceled:
+		return "canceled"
+	case EventRejected:
+		return "rejected"
+	default:
+		return "unknown"
+	}
+}
+
+// Record is an order tracked by the OMS
+type Record struct {
+	goup.Order
+	Exchange string
+	// Strategy tags the order with its owner, it's free-form
+	Strategy string
+}
+
+// Event is a transition of an order, Record is the state after it
+type Event struct {
+	Type   EventType
+	Record Record
+	// Fill is the amount dealt since the previous event
+	Fill float64
+	// Err is why placing failed, only set on EventRejected
+	Err error
+}
+
+// Request is an order to be placed
+type Request struct {
+	Exchange string
+	Strategy string
+	Pair     goup.CurrencyPair
+	Side     goup.TradeSide
+	Price,
+	Amount float64
+}
+
+const eventTopic = "events"
+
+// Manager places orders and follows them until they are done, by polling
+// GetOrder and by updates fed to Update. Finished orders are forgotten once
+// their last event is emitted. It's safe for concurrent use.
+type Manager struct {
+	apis     map[string]goup.API
+	lock     sync.Mutex
+	orders   map[string]*Record
+	hooks    map[string]func(*Event)
+	journal  *Journal
+	retries  int
+	interval time.Duration
+	done     chan struct{}
+	// events are dropped once closed, publish holds pubLock for reading
+	// so that Close can't shut pubsub down underneath it
+	pubLock sync.RWMutex
+	pubsub  *util.PubSub
+	closed  bool
+}
+
+// New creates a manager of orders on apis, open orders are polled every
+// interval, 0 disables polling when updates are streamed.
+func New(interval time.Duration, apis ...goup.API) *Manager {
+	m := &Manager{
+		apis:     make(map[string]goup.API),
+		orders:   make(map[string]*Record),
+		hooks:    make(map[string]func(*Event)),
+		pubsub:   util.NewPubSub(64),
+		retries:  defaultRetries,
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+
+	for _, api := range apis {
+		m.apis[api.ExchangeName()] = api
+	}
+
+	if interval > 0 {
+		go m.loop()
+	}
+
+	return m
+}
+
+// SetJournal persists the orders of the manager to j, call it before
+// placing orders and follow it with Reconcile on startup.
+func (m *Manager) SetJournal(j *Journal) {
+	m.journal = j
+}
+
+// Close stops polling and closes event subscriptions
+func (m *Manager) Close() {
+	m.pubLock.Lock()
+	defer m.pubLock.Unlock()
+
+	if m.closed {
+		return
+	}
+
+	m.closed = true
+	close(m.done)
+	m.pubsub.Shutdown()
+}
+
+func (m *Manager) loop() {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.Refresh()
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// Subscribe hands every event to handler, like the websocket methods of
+// goup.API, opts set the backpressure.
+func (m *Manager) Subscribe(handler func(*Event), opts ...goup.SubOption) {
+	m.pubLock.RLock()
+	defer m.pubLock.RUnlock()
+
+	if m.closed {
+		return
+	}
+
+	cfg := goup.NewSubConfig(opts...)
+	ch := m.pubsub.SubWithPolicy(cfg.Backpressure, cfg.Dropped, eventTopic)
+	go func() {
+		for e := range ch {
+			handler(e.(*Event))
+		}
+	}()
+}
+
+// API returns the client of exchange
+func (m *Manager) API(exchange string) (goup.API, error) {
+	api, ok := m.apis[exchange]
+	if !ok {
+		return nil, ErrUnknownExchange
+	}
+
+	return api, nil
+}
+
+// Track starts tracking an order placed elsewhere, a New event is emitted
+// unless it's already done.
+func (m *Manager) Track(exchange, strategy string, order *goup.Order) *Record {
+	return m.track(exchange, strategy, "", order)
+}
+
+// track tracks an order, intentID is the journal intent it resolves if any
+func (m *Manager) track(exchange, strategy, intentID string, order *goup.Order) *Record {
+	r := &Record{Order: *order, Exchange: exchange, Strategy: strategy}
+	if r.CreateTime == 0 {
+		r.CreateTime = util.NowMs()
+	}
+
+	m.lock.Lock()
+	m.orders[key(exchange, order.OrderID)] = r
+	events := []*Event{{Type: EventNew, Record: *r}}
+	if r.Status.Done() || r.DealAmount > 0 {
+		events = append(events, transition(&goup.Order{}, r)...)
+	}
+	if r.Status.Done() {
+		delete(m.orders, key(exchange, order.OrderID))
+	}
+	rec := *r
+	m.lock.Unlock()
+
+	m.write(&journalEntry{Op: opPlaced, ID: intentID, Record: &rec})
+	if rec.Status.Done() {
+		m.write(&journalEntry{Op: opDone, Record: &rec})
+	}
+	m.publish(events...)
+	return &rec
+}
+
+// Update applies the latest state of an order, e.g. from a websocket
+// stream, and emits the resulting events. Untracked orders are ignored.
+func (m *Manager) Update(exchange string, order *goup.Order) {
+	m.lock.Lock()
+	r, ok := m.orders[key(exchange, order.OrderID)]
+	if !ok {
+		m.lock.Unlock()
+		return
+	}
+
+	events := transition(&r.Order, &Record{Order: *order, Exchange: exchange, Strategy: r.Strategy})
+	merge(&r.Order, order)
+	for _, e := range events {
+		e.Record = *r
+	}
+	rec := *r
+	if r.Status.Done() {
+		delete(m.orders, key(exchange, order.OrderID))
+	}
+	m.lock.Unlock()
+
+	if rec.Status.Done() {
+		m.write(&journalEntry{Op: opDone, Record: &rec})
+	}
+	m.publish(events...)
+}
+
+// Cancel cancels an order and refreshes its state, EventCanceled comes
+// from the refresh since the order may have filled in the meantime.
+func (m *Manager) Cancel(exchange, orderID string) error {
+	r, ok := m.Order(exchange, orderID)
+	if !ok {
+		return ErrUnknownOrder
+	}
+
+	api, err := m.API(exchange)
+	if err != nil {
+		return err
+	}
+
+	if _, err := api.CancelOrder(orderID, r.Currency); err != nil {
+		return err
+	}
+
+	return m.refresh(api, &r)
+}
+
+// Refresh polls the state of all open orders
+func (m *Manager) Refresh() {
+	for _, r := range m.OpenOrders(goup.CurrencyPair{}, "") {
+		api, err := m.API(r.Exchange)
+		if err != nil {
+			continue
+		}
+
+		if err := m.refresh(api, &r); err != nil {
+			log.Printf("ERROR\tfailed to get order %s on %s: %v", r.OrderID, r.Exchange, err)
+		}
+	}
+}
+
+func (m *Manager) refresh(api goup.API, r *Record) error {
+	order, err := api.GetOrder(r.OrderID, r.Currency)
+	if err != nil {
+		return err
+	}
+
+	if order.OrderID == "" {
+		order.OrderID = r.OrderID
+	}
+	m.Update(r.Exchange, order)
+	return nil
+}
+
+// Order returns a tracked order
+func (m *Manager) Order(exchange, orderID string) (Record, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	r, ok := m.orders[key(exchange, orderID)]
+	if !ok {
+		return Record{}, false
+	}
+
+	return *r, true
+}
+
+// OpenOrders returns the tracked orders of pair and strategy, oldest first.
+// The zero pair and an empty strategy match all.
+func (m *Manager) OpenOrders(pair goup.CurrencyPair, strategy string) []Record {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var records []Record
+	for _, r := range m.orders {
+		if pair != (goup.CurrencyPair{}) && r.Currency != pair {
+			continue
+		}
+
+		if strategy != "" && r.Strategy != strategy {
+			continue
+		}
+
+		records = append(records, *r)
+	}
+
+	sortRecords(records)
+	return records
+}
+
+// write appends to the journal if any, failures are logged since the order
+// exists on the exchange regardless
+func (m *Manager) write(e *journalEntry) {
+	if m.journal == nil {
+		return
+	}
+
+	if err := m.journal.write(e); err != nil {
+		log.Printf("ERROR\tfailed to write journal: %v", err)
+	}
+}
+
+// publish must be called without holding lock, handlers may query the manager
+// and hooks may place and cancel orders
+func (m *Manager) publish(events ...*Event) {
+	m.pubLock.RLock()
+	if m.closed {
+		m.pubLock.RUnlock()
+		return
+	}
+
+	for _, e := range events {
+		m.pubsub.Pub(e, eventTopic)
+	}
+	m.pubLock.RUnlock()
+
+	for _, e := range events {
+		m.lock.Lock()
+		fn := m.hooks[e.Record.ClientOrderID]
+		m.lock.Unlock()
+
+		if fn != nil {
+			fn(e)
+		}
+	}
+}
+
+// hook calls fn synchronously with the events of the order placed with
+// clientOrderID, register it before placing. A nil fn removes the hook.
+func (m *Manager) hook(clientOrderID string, fn func(*Event)) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if fn == nil {
+		delete(m.hooks, clientOrderID)
+		return
+	}
+	m.hooks[clientOrderID] = fn
+}
+
+func sortRecords(records []Record) {
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].CreateTime == records[j].CreateTime {
+			return records[i].OrderID < records[j].OrderID
+		}
+		return records[i].CreateTime < records[j].CreateTime
+	})
+}
+
+func key(exchange, orderID string) string {
+	return exchange + "/" + orderID
+}
+
+// transition returns the events leading from prev to next,
+// the caller fills in their records
+func transition(prev *goup.Order, next *Record) []*Event {
+	var events []*Event
+	fill := next.DealAmount - prev.DealAmount
+	if fill > 0 && next.Status != goup.Filled {
+		events = append(events, &Event{Type: EventPartialFill, Record: *next, Fill: fill})
+	}
+
+	if next.Status == prev.Status {
+		return events
+	}
+
+	switch next.Status {
+	case goup.Filled:
+		events = append(events, &Event{Type: EventFilled, Record: *next, Fill: fill})
+	case goup.Canceled, goup.Expired:
+		events = append(events, &Event{Type: EventCanceled, Record: *next})
+	case goup.Rejected:
+		events = append(events, &Event{Type: EventRejected, Record: *next})
+	}
+
+	return events
+}
+
+// merge copies the state of next into o, keeping what next leaves out
+func merge(o, next *goup.Order) {
+	o.Status = next.Status
+	if next.DealAmount > o.DealAmount {
+		o.DealAmount = next.DealAmount
+	}
+	if next.AvgPrice != 0 {
+		o.AvgPrice = next.AvgPrice
+	}
+	if next.Fee != 0 {
+		o.Fee = next.Fee
+	}
+	if next.FinishTime != 0 {
+		o.FinishTime = next.FinishTime
+	}
+	if o.Price == 0 {
+		o.Price = next.Price
+	}
+	if o.Amount == 0 {
+		o.Amount = next.Amount
+	}
+}
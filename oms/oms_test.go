@@ -0,0 +1,275 @@
+package oms
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jflyup/goup"
+	"github.com/jflyup/goup/util"
+)
+
+var pair = goup.NewCurrencyPair("LYM", "ETH")
+
+// fakeExchange keeps orders in memory, fill simulates trades
+type fakeExchange struct {
+	goup.API
+	name     string
+	lock     sync.Mutex
+	nextID   int
+	orders   map[string]*goup.Order
+	placeErr error
+	// lost is how many of the next orders are placed but answered with a
+	// timeout, down how many aren't placed and time out
+	lost, down int
+	// block, if set, is signaled once placing started and placing goes on
+	// once signaled back
+	block chan struct{}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func newFakeExchange(name string) *fakeExchange {
+	return &fakeExchange{name: name, orders: make(map[string]*goup.Order)}
+}
+
+func (f *fakeExchange) ExchangeName() string {
+	return f.name
+}
+
+func (f *fakeExchange) LimitBuy(amount, price float64, pair goup.CurrencyPair) (*goup.Order, error) {
+	return f.place(amount, price, pair, goup.Buy)
+}
+
+func (f *fakeExchange) LimitSell(amount, price float64, pair goup.CurrencyPair) (*goup.Order, error) {
+	return f.place(amount, price, pair, goup.Sell)
+}
+
+func (f *fakeExchange) place(amount, price float64, pair goup.CurrencyPair, side goup.TradeSide) (*goup.Order, error) {
+	return f.placeWithID("", amount, price, pair, side)
+}
+
+func (f *fakeExchange) placeWithID(clientOrderID string, amount, price float64, pair goup.CurrencyPair, side goup.TradeSide) (*goup.Order, error) {
+	f.lock.Lock()
+	block := f.block
+	f.lock.Unlock()
+	if block != nil {
+		block <- struct{}{}
+		<-block
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.placeErr != nil {
+		return nil, f.placeErr
+	}
+
+	if f.down > 0 {
+		f.down--
+		return nil, timeoutError{}
+	}
+
+	f.nextID++
+	id := strconv.Itoa(f.nextID)
+	f.orders[id] = &goup.Order{OrderID: id, Price: price, Amount: amount, Currency: pair, Side: side,
+		CreateTime: util.NowMs(), ClientOrderID: clientOrderID}
+
+	if f.lost > 0 {
+		f.lost--
+		return nil, timeoutError{}
+	}
+	return &goup.Order{OrderID: id, Side: side}, nil
+}
+
+func (f *fakeExchange) placed() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return len(f.orders)
+}
+
+func (f *fakeExchange) GetOrder(orderID string, pair goup.CurrencyPair) (*goup.Order, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	o, ok := f.orders[orderID]
+	if !ok {
+		return nil, errors.New("order not found")
+	}
+
+	order := *o
+	return &order, nil
+}
+
+func (f *fakeExchange) CancelOrder(orderID string, pair goup.CurrencyPair) (bool, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	o, ok := f.orders[orderID]
+	if !ok || o.Status == goup.Filled || o.Status == goup.Canceled {
+		return false, errors.New("order not open")
+	}
+
+	o.Status = goup.Canceled
+	return true, nil
+}
+
+func (f *fakeExchange) OpenOrders(pair goup.CurrencyPair) ([]*goup.Order, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	var open []*goup.Order
+	for _, o := range f.orders {
+		if o.Status == goup.Submitted || o.Status == goup.PartialFilled {
+			order := *o
+			open = append(open, &order)
+		}
+	}
+	return open, nil
+}
+
+func (f *fakeExchange) GetOrderHistory(pair goup.CurrencyPair, currentPage, pageSize int) ([]goup.Order, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	var history []goup.Order
+	for _, o := range f.orders {
+		if o.Status == goup.Filled || o.Status == goup.Canceled {
+			history = append(history, *o)
+		}
+	}
+	return history, nil
+}
+
+func (f *fakeExchange) fill(orderID string, amount float64) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	o := f.orders[orderID]
+	o.DealAmount += amount
+	o.AvgPrice = o.Price
+	if o.DealAmount >= o.Amount {
+		o.Status = goup.Filled
+	} else {
+		o.Status = goup.PartialFilled
+	}
+}
+
+func collect(m *Manager) chan *Event {
+	ch := make(chan *Event, 64)
+	m.Subscribe(func(e *Event) {
+		ch <- e
+	})
+	return ch
+}
+
+func expect(t *testing.T, ch chan *Event, typ EventType, fill float64) *Event {
+	t.Helper()
+	select {
+	case e := <-ch:
+		if e.Type != typ || e.Fill != fill {
+			t.Errorf("got %s event filling %f, want %s filling %f", e.Type, e.Fill, typ, fill)
+		}
+		return e
+	case <-time.After(time.Second):
+		t.Fatalf("no %s event", typ)
+		return nil
+	}
+}
+
+func TestManagerLifecycle(t *testing.T) {
+	ex := newFakeExchange("fake")
+	m := New(0, ex)
+	defer m.Close()
+	events := collect(m)
+
+	r, err := m.Place(&Request{Exchange: "fake", Strategy: "grid", Pair: pair, Side: goup.Buy, Price: 2, Amount: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := expect(t, events, EventNew, 0); e.Record.Price != 2 || e.Record.Strategy != "grid" {
+		t.Errorf("new order: %+v", e.Record)
+	}
+
+	ex.fill(r.OrderID, 1)
+	m.Refresh()
+	expect(t, events, EventPartialFill, 1)
+
+	// nothing changed, nothing emitted
+	m.Refresh()
+
+	ex.fill(r.OrderID, 2)
+	m.Refresh()
+	if e := expect(t, events, EventFilled, 2); e.Record.DealAmount != 3 || e.Record.Status != goup.Filled {
+		t.Errorf("filled order: %+v", e.Record)
+	}
+
+	if _, ok := m.Order("fake", r.OrderID); ok {
+		t.Error("filled order still tracked")
+	}
+
+	r1, _ := m.Place(&Request{Exchange: "fake", Strategy: "grid", Pair: pair, Side: goup.Sell, Price: 3, Amount: 1})
+	r2, _ := m.Place(&Request{Exchange: "fake", Strategy: "arb", Pair: pair, Side: goup.Sell, Price: 4, Amount: 1})
+	expect(t, events, EventNew, 0)
+	expect(t, events, EventNew, 0)
+
+	if open := m.OpenOrders(pair, "arb"); len(open) != 1 || open[0].OrderID != r2.OrderID {
+		t.Errorf("open orders of arb: %+v", open)
+	}
+	if open := m.OpenOrders(goup.CurrencyPair{}, ""); len(open) != 2 {
+		t.Errorf("got %d open orders, want 2", len(open))
+	}
+
+	if err := m.Cancel("fake", r1.OrderID); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, events, EventCanceled, 0)
+
+	if err := m.Cancel("fake", r1.OrderID); err != ErrUnknownOrder {
+		t.Errorf("canceling twice: %v", err)
+	}
+
+	ex.placeErr = errors.New("insufficient balance")
+	if _, err := m.Place(&Request{Exchange: "fake", Pair: pair, Price: 1, Amount: 1}); err == nil {
+		t.Error("placing didn't fail")
+	}
+	if e := expect(t, events, EventRejected, 0); e.Err != ex.placeErr {
+		t.Errorf("rejected: %v", e.Err)
+	}
+
+	if _, err := m.Place(&Request{Exchange: "nowhere"}); err != ErrUnknownExchange {
+		t.Errorf("unknown exchange: %v", err)
+	}
+}
+
+func TestManagerUpdate(t *testing.T) {
+	ex := newFakeExchange("fake")
+	m := New(0, ex)
+	defer m.Close()
+	events := collect(m)
+
+	m.Track("fake", "", &goup.Order{OrderID: "42", Price: 1, Amount: 2, Currency: pair})
+	expect(t, events, EventNew, 0)
+
+	// a streamed update canceling a partially filled order
+	m.Update("fake", &goup.Order{OrderID: "42", DealAmount: 0.5, Status: goup.Canceled})
+	expect(t, events, EventPartialFill, 0.5)
+	if e := expect(t, events, EventCanceled, 0); e.Record.Price != 1 || e.Record.DealAmount != 0.5 {
+		t.Errorf("canceled order: %+v", e.Record)
+	}
+
+	// untracked orders are ignored
+	m.Update("fake", &goup.Order{OrderID: "43", Status: goup.Filled})
+	select {
+	case e := <-events:
+		t.Errorf("unexpected event %+v", e)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
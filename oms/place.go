@@ -0,0 +1,185 @@
+package oms
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"time"
+
+	"github.com/jflyup/goup"
+	"github.com/jflyup/goup/util"
+)
+
+// defaultRetries is how many times an order is placed again after an
+// ambiguous failure, once it's known not to have landed
+const defaultRetries = 2
+
+// clockSkew is tolerated between the exchange and us when matching
+// order history by creation time
+const clockSkew = 5 * time.Second
+
+// historySize is the number of recent orders searched for a lost order
+const historySize = 20
+
+// AmbiguousError is returned by Place when the order may or may not exist
+// and looking it up failed. Its intent is kept in the journal, Reconcile
+// resolves it.
+type AmbiguousError struct {
+	Err error
+}
+
+func (e *AmbiguousError) Error() string {
+	return fmt.Sprintf("order may have been placed: %v", e.Err)
+}
+
+// SetRetries sets how many times an order is placed again after a failure
+// which left it unknown whether the order landed
+func (m *Manager) SetRetries(n int) {
+	m.retries = n
+}
+
+// Place places a limit order and starts tracking it. Every order gets a
+// client order ID, sent along on exchanges implementing
+// goup.ClientOrderPlacer. When placing fails ambiguously, e.g. on a timeout,
+// open orders and recent history are searched for the order before placing it
+// again, so it's never placed twice.
+func (m *Manager) Place(req *Request) (*Record, error) {
+	return m.place(req, util.NewID())
+}
+
+// place places req with the client order ID id
+func (m *Manager) place(req *Request, id string) (*Record, error) {
+	api, err := m.API(req.Exchange)
+	if err != nil {
+		return nil, err
+	}
+
+	// the intent is on disk before the order may exist
+	m.write(&journalEntry{Op: opIntent, ID: id, Request: req})
+
+	since := time.Now().Add(-clockSkew)
+	for attempt := 0; ; attempt++ {
+		order, err := placeLimit(api, id, req)
+		if err == nil {
+			return m.placed(req, id, order), nil
+		}
+
+		if !ambiguous(err) {
+			m.reject(req, id, err)
+			return nil, err
+		}
+
+		log.Printf("ERROR\tplacing order %s on %s: %v, looking it up", id, req.Exchange, err)
+		order, found, lookupErr := m.locate(api, req, id, since)
+		if lookupErr != nil {
+			return nil, &AmbiguousError{Err: err}
+		}
+
+		if found {
+			return m.placed(req, id, order), nil
+		}
+
+		if attempt >= m.retries {
+			m.reject(req, id, err)
+			return nil, err
+		}
+	}
+}
+
+// reject drops an intent known not to have become an order
+func (m *Manager) reject(req *Request, id string, err error) {
+	m.write(&journalEntry{Op: opAbandon, ID: id})
+	m.publish(&Event{Type: EventRejected, Record: Record{
+		Order: goup.Order{Price: req.Price, Amount: req.Amount, Currency: req.Pair, Side: req.Side,
+			Status: goup.Rejected, ClientOrderID: id},
+		Exchange: req.Exchange,
+		Strategy: req.Strategy,
+	}, Err: err})
+}
+
+func placeLimit(api goup.API, clientOrderID string, req *Request) (*goup.Order, error) {
+	if p, ok := api.(goup.ClientOrderPlacer); ok {
+		return p.PlaceLimitOrder(clientOrderID, req.Side, req.Amount, req.Price, req.Pair)
+	}
+
+	if req.Side == goup.Buy {
+		return api.LimitBuy(req.Amount, req.Price, req.Pair)
+	}
+	return api.LimitSell(req.Amount, req.Price, req.Pair)
+}
+
+func (m *Manager) placed(req *Request, id string, order *goup.Order) *Record {
+	// adapters fill in little more than the order ID
+	order.Price = req.Price
+	order.Amount = req.Amount
+	order.Currency = req.Pair
+	order.Side = req.Side
+	order.ClientOrderID = id
+	return m.track(req.Exchange, req.Strategy, id, order)
+}
+
+// locate searches open orders and recent history for an order placed from
+// req. Orders are matched by client order ID where the exchange echoes it,
+// otherwise by side, price and amount among the orders we don't track.
+// goup.ErrUnsupported is returned when it's not open and the exchange keeps
+// no history.
+func (m *Manager) locate(api goup.API, req *Request, id string, since time.Time) (*goup.Order, bool, error) {
+	open, err := api.OpenOrders(req.Pair)
+	if err != nil {
+		return nil, false, err
+	}
+
+	for _, o := range open {
+		if m.matches(req, id, o) {
+			return o, true, nil
+		}
+	}
+
+	// it may have been filled already
+	history, err := api.GetOrderHistory(req.Pair, 1, historySize)
+	if err != nil {
+		return nil, false, err
+	}
+
+	for i := range history {
+		o := &history[i]
+		// without a client order ID, an older fill of ours looks the same
+		if o.ClientOrderID == "" && o.CreateTime < since.UnixNano()/int64(time.Millisecond) {
+			continue
+		}
+
+		if m.matches(req, id, o) {
+			return o, true, nil
+		}
+	}
+
+	return nil, false, nil
+}
+
+func (m *Manager) matches(req *Request, id string, o *goup.Order) bool {
+	if o.ClientOrderID != "" {
+		return o.ClientOrderID == id
+	}
+
+	if _, tracked := m.Order(req.Exchange, o.OrderID); tracked {
+		return false
+	}
+
+	return o.Side == req.Side && o.Price == req.Price && o.Amount == req.Amount
+}
+
+// ambiguous reports whether err leaves it unknown if the order was placed:
+// the request may have reached the exchange before the connection failed,
+// or the exchange failed after accepting it
+func ambiguous(err error) bool {
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+
+	if e, ok := err.(*goup.HttpError); ok {
+		return e.StatusCode >= 500
+	}
+
+	return err == io.EOF || err == io.ErrUnexpectedEOF
+}
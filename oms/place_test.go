@@ -0,0 +1,105 @@
+package oms
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jflyup/goup"
+)
+
+// clientIDExchange takes client order IDs and echoes them
+type clientIDExchange struct {
+	*fakeExchange
+}
+
+func (c clientIDExchange) PlaceLimitOrder(clientOrderID string, side goup.TradeSide, amount, price float64, pair goup.CurrencyPair) (*goup.Order, error) {
+	return c.placeWithID(clientOrderID, amount, price, pair, side)
+}
+
+// historyDown fails looking up order history
+type historyDown struct {
+	*fakeExchange
+}
+
+func (h historyDown) GetOrderHistory(pair goup.CurrencyPair, currentPage, pageSize int) ([]goup.Order, error) {
+	return nil, errors.New("service unavailable")
+}
+
+// noHistory keeps no order history, like coinbene
+type noHistory struct {
+	*fakeExchange
+}
+
+func (h noHistory) GetOrderHistory(pair goup.CurrencyPair, currentPage, pageSize int) ([]goup.Order, error) {
+	return nil, goup.ErrUnsupported
+}
+
+func TestPlaceIdempotent(t *testing.T) {
+	ex := newFakeExchange("fake")
+	m := New(0, ex)
+	defer m.Close()
+	req := &Request{Exchange: "fake", Pair: pair, Side: goup.Buy, Price: 2, Amount: 1}
+
+	// the order landed, its response was lost
+	ex.lost = 1
+	r, err := m.Place(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ex.placed() != 1 || r.OrderID != "1" || r.ClientOrderID == "" {
+		t.Errorf("got %+v, %d orders placed", r, ex.placed())
+	}
+
+	// not placed, the identical order tracked already isn't mistaken for it
+	ex.down = 1
+	if r, err = m.Place(req); err != nil {
+		t.Fatal(err)
+	}
+	if ex.placed() != 2 || r.OrderID != "2" {
+		t.Errorf("got %+v, %d orders placed", r, ex.placed())
+	}
+
+	// not placed and out of retries
+	m.SetRetries(0)
+	ex.down = 1
+	if _, err := m.Place(req); err == nil {
+		t.Error("placing didn't fail")
+	}
+	if ex.placed() != 2 {
+		t.Errorf("got %d orders placed, want 2", ex.placed())
+	}
+}
+
+func TestPlaceLocate(t *testing.T) {
+	ex := newFakeExchange("fake")
+	m := New(0, ex)
+	defer m.Close()
+
+	// filled at once, it's only in history
+	r, _ := ex.LimitBuy(1, 2, pair)
+	ex.fill(r.OrderID, 1)
+	o, found, err := m.locate(ex, &Request{Exchange: "fake", Pair: pair, Side: goup.Buy, Price: 2, Amount: 1}, "x", time.Time{})
+	if err != nil || !found || o.OrderID != r.OrderID {
+		t.Errorf("locate in history: %+v %v %v", o, found, err)
+	}
+
+	// client order IDs win over the order details
+	cex := clientIDExchange{newFakeExchange("fake")}
+	cex.PlaceLimitOrder("a", goup.Buy, 1, 2, pair)
+	cex.PlaceLimitOrder("b", goup.Buy, 1, 2, pair)
+	o, found, _ = m.locate(cex, &Request{Exchange: "fake", Pair: pair, Side: goup.Buy, Price: 2, Amount: 1}, "b", time.Time{})
+	if !found || o.ClientOrderID != "b" {
+		t.Errorf("locate by client order ID: %+v", o)
+	}
+
+	// the lookup fails, the outcome is unknown
+	hex := historyDown{newFakeExchange("down")}
+	m = New(0, hex)
+	defer m.Close()
+	hex.down = 1
+	_, err = m.Place(&Request{Exchange: "down", Pair: pair, Price: 1, Amount: 1})
+	if _, ok := err.(*AmbiguousError); !ok {
+		t.Errorf("got %v, want an AmbiguousError", err)
+	}
+}
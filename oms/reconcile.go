@@ -0,0 +1,174 @@
+package oms
+
+import (
+	"sort"
+	"time"
+
+	"github.com/jflyup/goup"
+)
+
+// Reconciliation is the outcome of Reconcile
+type Reconciliation struct {
+	// Adopted orders are open on the exchange and tracked again
+	Adopted []Record
+	// Filled orders were filled while the process was down, fully or
+	// partially before being canceled
+	Filled []Record
+	// Closed orders were canceled or rejected without any fill
+	Closed []Record
+	// Orphans are open on the exchange but unknown to the journal,
+	// they are left alone and not tracked
+	Orphans []Record
+	// Unresolved intents were sent but no order ID came back and neither
+	// open orders nor recent history match them, they may have been filled
+	// long ago or never placed. They are dropped from the journal once
+	// reported.
+	Unresolved []Request
+	// Pending intents are neither open nor ruled out, their exchange keeps no
+	// order history. They stay in the journal for the next Reconcile.
+	Pending []Request
+}
+
+// resolved is an order of the journal or found for an intent, tracked once
+// every lookup succeeded
+type resolved struct {
+	order    goup.Order
+	exchange string
+	strategy string
+	// intentID and req are set for the orders of intents
+	intentID string
+	req      *Request
+}
+
+// Reconcile checks the orders pending in the journal against the exchanges,
+// to be called on startup after SetJournal. Orders still open are tracked
+// again, events are emitted for what happened while the process was down.
+// Nothing is tracked if a lookup fails, Reconcile may be called again then.
+func (m *Manager) Reconcile() (*Reconciliation, error) {
+	if m.journal == nil {
+		return nil, ErrNoJournal
+	}
+
+	intents, records := m.journal.pending()
+	var orders []*resolved
+	known := make(map[string]bool)
+	// open orders are listed by pair, scan every pair we had business in
+	pairs := make(map[string]map[goup.CurrencyPair]bool)
+	addPair := func(exchange string, pair goup.CurrencyPair) {
+		if pairs[exchange] == nil {
+			pairs[exchange] = make(map[goup.CurrencyPair]bool)
+		}
+		pairs[exchange][pair] = true
+	}
+
+	for _, r := range records {
+		api, err := m.API(r.Exchange)
+		if err != nil {
+			return nil, err
+		}
+
+		order, err := api.GetOrder(r.OrderID, r.Currency)
+		if err != nil {
+			return nil, err
+		}
+
+		known[key(r.Exchange, r.OrderID)] = true
+		addPair(r.Exchange, r.Currency)
+		merge(&r.Order, order)
+		orders = append(orders, &resolved{order: r.Order, exchange: r.Exchange, strategy: r.Strategy})
+	}
+
+	// intents are searched like a lost order of Place, in a stable order
+	// since the same order may match several of them
+	ids := make([]string, 0, len(intents))
+	for id := range intents {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var unresolved, pending []string
+	for _, id := range ids {
+		in := intents[id]
+		addPair(in.Exchange, in.Pair)
+		api, err := m.API(in.Exchange)
+		if err != nil {
+			return nil, err
+		}
+
+		since := time.Unix(0, in.Time*int64(time.Millisecond)).Add(-clockSkew)
+		order, found, err := m.locate(api, &in.Request, id, since)
+		if err == goup.ErrUnsupported {
+			pending = append(pending, id)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		// nothing is tracked yet, locate can't tell the orders taken already
+		if !found || known[key(in.Exchange, order.OrderID)] {
+			unresolved = append(unresolved, id)
+			continue
+		}
+
+		known[key(in.Exchange, order.OrderID)] = true
+		req := in.Request
+		orders = append(orders, &resolved{order: *order, exchange: in.Exchange, intentID: id, req: &req})
+	}
+
+	var orphans []Record
+	for exchange, ps := range pairs {
+		api, err := m.API(exchange)
+		if err != nil {
+			return nil, err
+		}
+
+		for pair := range ps {
+			open, err := api.OpenOrders(pair)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, o := range open {
+				if known[key(exchange, o.OrderID)] {
+					continue
+				}
+
+				if o.Currency == (goup.CurrencyPair{}) {
+					o.Currency = pair
+				}
+				orphans = append(orphans, Record{Order: *o, Exchange: exchange})
+			}
+		}
+	}
+
+	rec := &Reconciliation{Orphans: orphans}
+	for _, r := range orders {
+		var tracked Record
+		if r.req != nil {
+			tracked = *m.placed(r.req, r.intentID, &r.order)
+		} else {
+			tracked = *m.Track(r.exchange, r.strategy, &r.order)
+		}
+
+		switch {
+		case !tracked.Status.Done():
+			rec.Adopted = append(rec.Adopted, tracked)
+		case tracked.DealAmount > 0:
+			rec.Filled = append(rec.Filled, tracked)
+		default:
+			rec.Closed = append(rec.Closed, tracked)
+		}
+	}
+
+	for _, id := range unresolved {
+		m.write(&journalEntry{Op: opAbandon, ID: id})
+		rec.Unresolved = append(rec.Unresolved, intents[id].Request)
+	}
+
+	for _, id := range pending {
+		rec.Pending = append(rec.Pending, intents[id].Request)
+	}
+
+	sortRecords(rec.Orphans)
+	return rec, nil
+}
@@ -0,0 +1,431 @@
+package goup
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrNoOrderBook is returned when a delta arrives before the snapshot
+var ErrNoOrderBook = errors.New("no local order book")
+
+// maxLevel bounds the height of the skip lists, 4^16 levels are far more
+// than any order book holds
+const maxLevel = 16
+
+// OrderBook is a local order book maintained from snapshots and deltas.
+// Price levels are kept in skip lists, so applying a delta costs O(log n)
+// instead of shifting a sorted slice. It's not safe for concurrent use.
+type OrderBook struct {
+	Pair CurrencyPair
+	// Ts, LocalTs and Seq are taken from the last snapshot or delta applied
+	Ts,
+	LocalTs int64
+	Seq        uint64
+	asks       *priceLevels
+	bids       *priceLevels
+	checksum   ChecksumFunc
+	mismatches uint64
+}
+
+// NewOrderBook creates an empty order book of pair
+func NewOrderBook(pair CurrencyPair) *OrderBook {
+	return &OrderBook{
+		Pair: pair,
+		asks: newPriceLevels(false),
+		bids: newPriceLevels(true),
+	}
+}
+
+// SetChecksum installs the checksum function of the exchange,
+// deltas carrying a checksum are verified by Update.
+func (ob *OrderBook) SetChecksum(fn ChecksumFunc) {
+	ob.checksum = fn
+}
+
+// Reset replaces the whole book with a snapshot
+func (ob *OrderBook) Reset(snapshot *Depth) {
+	ob.asks = newPriceLevels(false)
+	ob.bids = newPriceLevels(true)
+	ob.stamp(snapshot)
+	for _, ask := range snapshot.AskList {
+		ob.asks.set(ask)
+	}
+
+	for _, bid := range snapshot.BidList {
+		ob.bids.set(bid)
+	}
+}
+
+// Update applies a delta, a record with zero amount removes the price level.
+// If the delta carries a checksum and a checksum function is installed, the
+// resulting book is verified and ErrChecksum returned on mismatch, the book
+// is out of sync then and must be reset from a new snapshot.
+func (ob *OrderBook) Update(delta *Depth) error {
+	ob.stamp(delta)
+	for _, ask := range delta.AskList {
+		ob.asks.set(ask)
+	}
+
+	for _, bid := range delta.BidList {
+		ob.bids.set(bid)
+	}
+
+	if ob.checksum != nil && delta.Checksum != 0 && ob.checksum(ob) != delta.Checksum {
+		ob.mismatches++
+		return ErrChecksum
+	}
+
+	return nil
+}
+
+func (ob *OrderBook) stamp(d *Depth) {
+	ob.Ts = d.Ts
+	ob.LocalTs = d.LocalTs
+	ob.Seq = d.Seq
+}
+
+// Mismatches returns how many times the book failed verification
+func (ob *OrderBook) Mismatches() uint64 {
+	return ob.mismatches
+}
+
+// UpdateAsk sets the amount of a single ask level, zero amount removes it
+func (ob *OrderBook) UpdateAsk(r DepthRecord) {
+	ob.asks.set(r)
+}
+
+// UpdateBid sets the amount of a single bid level, zero amount removes it
+func (ob *OrderBook) UpdateBid(r DepthRecord) {
+	ob.bids.set(r)
+}
+
+// AskAmount returns the amount at ask price, 0 if there's no such level
+func (ob *OrderBook) AskAmount(price float64) float64 {
+	return ob.asks.get(price)
+}
+
+// BidAmount returns the amount at bid price, 0 if there's no such level
+func (ob *OrderBook) BidAmount(price float64) float64 {
+	return ob.bids.get(price)
+}
+
+// Len returns the number of ask and bid levels
+func (ob *OrderBook) Len() (asks, bids int) {
+	return ob.asks.len, ob.bids.len
+}
+
+// BestAsk returns the lowest ask, ok is false if there's no ask
+func (ob *OrderBook) BestAsk() (r DepthRecord, ok bool) {
+	return ob.asks.first()
+}
+
+// BestBid returns the highest bid, ok is false if there's no bid
+func (ob *OrderBook) BestBid() (r DepthRecord, ok bool) {
+	return ob.bids.first()
+}
+
+// Spread returns best ask minus best bid, or 0 if either side is empty
+func (ob *OrderBook) Spread() float64 {
+	ask, okAsk := ob.BestAsk()
+	bid, okBid := ob.BestBid()
+	if !okAsk || !okBid {
+		return 0
+	}
+
+	return ask.Price - bid.Price
+}
+
+// Mid returns the mean of best ask and best bid, or 0 if either side is empty
+func (ob *OrderBook) Mid() float64 {
+	ask, okAsk := ob.BestAsk()
+	bid, okBid := ob.BestBid()
+	if !okAsk || !okBid {
+		return 0
+	}
+
+	return (ask.Price + bid.Price) / 2
+}
+
+// TopN returns a copy of the best n levels of each side, asks ascending and
+// bids descending. n <= 0 means the whole book.
+func (ob *OrderBook) TopN(n int) *Depth {
+	return &Depth{
+		Pair:    ob.Pair,
+		AskList: ob.asks.top(n),
+		BidList: ob.bids.top(n),
+		Ts:      ob.Ts,
+		LocalTs: ob.LocalTs,
+		Seq:     ob.Seq,
+	}
+}
+
+// Depth returns a copy of the whole book
+func (ob *OrderBook) Depth() *Depth {
+	return ob.TopN(0)
+}
+
+// OrderBooks is a set of local order books keyed by pair, it's safe for
+// concurrent use. Every change produces a new snapshot which is never modified
+// afterwards, so snapshots can be handed to handlers running in other
+// goroutines, they must be treated as read-only.
+type OrderBooks struct {
+	lock      sync.RWMutex
+	books     map[CurrencyPair]*OrderBook
+	snapshots map[CurrencyPair]*Depth
+	checksum  ChecksumFunc
+	// resyncs and mismatches outlive the books dropped
+	resyncs,
+	mismatches uint64
+}
+
+// NewOrderBooks creates an empty set of order books
+func NewOrderBooks() *OrderBooks {
+	return &OrderBooks{
+		books:     make(map[CurrencyPair]*OrderBook),
+		snapshots: make(map[CurrencyPair]*Depth),
+	}
+}
+
+// SetChecksum installs the checksum function on all books, present and future
+func (obs *OrderBooks) SetChecksum(fn ChecksumFunc) {
+	obs.lock.Lock()
+	defer obs.lock.Unlock()
+
+	obs.checksum = fn
+	for _, ob := range obs.books {
+		ob.SetChecksum(fn)
+	}
+}
+
+// Reset replaces the book of snapshot.Pair, creating it if needed,
+// and returns a new snapshot of it.
+func (obs *OrderBooks) Reset(snapshot *Depth) *Depth {
+	obs.lock.Lock()
+	defer obs.lock.Unlock()
+
+	ob, ok := obs.books[snapshot.Pair]
+	if !ok {
+		ob = NewOrderBook(snapshot.Pair)
+		ob.SetChecksum(obs.checksum)
+		obs.books[snapshot.Pair] = ob
+	}
+	ob.Reset(snapshot)
+
+	return obs.snapshot(ob)
+}
+
+// Update applies delta to the book of delta.Pair and returns a new snapshot
+// of it. ErrNoOrderBook is returned if there's no book yet, if the book fails
+// verification it's dropped and ErrChecksum returned.
+func (obs *OrderBooks) Update(delta *Depth) (*Depth, error) {
+	obs.lock.Lock()
+	defer obs.lock.Unlock()
+
+	ob, ok := obs.books[delta.Pair]
+	if !ok {
+		return nil, ErrNoOrderBook
+	}
+
+	if err := ob.Update(delta); err != nil {
+		obs.drop(delta.Pair, err)
+		return nil, err
+	}
+
+	return obs.snapshot(ob), nil
+}
+
+// Apply runs fn on the book of pair under the lock, for exchanges whose deltas
+// can't be expressed as a Depth, and returns a new snapshot. ErrNoOrderBook is
+// returned if there's no book yet, the book is dropped if fn fails.
+func (obs *OrderBooks) Apply(pair CurrencyPair, fn func(ob *OrderBook) error) (*Depth, error) {
+	obs.lock.Lock()
+	defer obs.lock.Unlock()
+
+	ob, ok := obs.books[pair]
+	if !ok {
+		return nil, ErrNoOrderBook
+	}
+
+	if err := fn(ob); err != nil {
+		obs.drop(pair, err)
+		return nil, err
+	}
+
+	return obs.snapshot(ob), nil
+}
+
+// Snapshot returns the latest snapshot of pair, nil if there's no book
+func (obs *OrderBooks) Snapshot(pair CurrencyPair) *Depth {
+	obs.lock.RLock()
+	defer obs.lock.RUnlock()
+
+	return obs.snapshots[pair]
+}
+
+// Delete drops the book of pair
+func (obs *OrderBooks) Delete(pair CurrencyPair) {
+	obs.lock.Lock()
+	defer obs.lock.Unlock()
+
+	delete(obs.books, pair)
+	delete(obs.snapshots, pair)
+}
+
+// Resyncs returns how many books were dropped because a delta failed, each
+// one needs a new snapshot
+func (obs *OrderBooks) Resyncs() uint64 {
+	obs.lock.RLock()
+	defer obs.lock.RUnlock()
+
+	return obs.resyncs
+}
+
+// Mismatches returns how many deltas failed verification, across all books
+func (obs *OrderBooks) Mismatches() uint64 {
+	obs.lock.RLock()
+	defer obs.lock.RUnlock()
+
+	return obs.mismatches
+}
+
+// drop deletes the book of pair after a failed delta, the caller must hold
+// the write lock
+func (obs *OrderBooks) drop(pair CurrencyPair, err error) {
+	obs.resyncs++
+	if err == ErrChecksum {
+		obs.mismatches++
+	}
+	delete(obs.books, pair)
+	delete(obs.snapshots, pair)
+}
+
+// snapshot copies ob, the caller must hold the write lock
+func (obs *OrderBooks) snapshot(ob *OrderBook) *Depth {
+	d := ob.Depth()
+	obs.snapshots[ob.Pair] = d
+	return d
+}
+
+type levelNode struct {
+	DepthRecord
+	next []*levelNode
+}
+
+// priceLevels is a skip list of depth records ordered by price
+type priceLevels struct {
+	desc  bool
+	head  levelNode
+	level int
+	len   int
+	seed  uint64
+}
+
+func newPriceLevels(desc bool) *priceLevels {
+	return &priceLevels{
+		desc:  desc,
+		head:  levelNode{next: make([]*levelNode, maxLevel)},
+		level: 1,
+		seed:  0x9E3779B97F4A7C15,
+	}
+}
+
+// before reports whether price a is closer to the top of the book than b
+func (l *priceLevels) before(a, b float64) bool {
+	if l.desc {
+		return a > b
+	}
+	return a < b
+}
+
+// randomLevel returns a level with P(level > k) = 4^-k
+func (l *priceLevels) randomLevel() int {
+	// xorshift64, math/rand is too slow and locked
+	l.seed ^= l.seed << 13
+	l.seed ^= l.seed >> 7
+	l.seed ^= l.seed << 17
+
+	level := 1
+	for r := l.seed; level < maxLevel && r&3 == 0; r >>= 2 {
+		level++
+	}
+	return level
+}
+
+func (l *priceLevels) set(r DepthRecord) {
+	var update [maxLevel]*levelNode
+	x := &l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && l.before(x.next[i].Price, r.Price) {
+			x = x.next[i]
+		}
+		update[i] = x
+	}
+
+	if x = x.next[0]; x != nil && x.Price == r.Price {
+		if r.Amount != 0 {
+			x.Amount = r.Amount
+			return
+		}
+
+		for i := 0; i < l.level && update[i].next[i] == x; i++ {
+			update[i].next[i] = x.next[i]
+		}
+		for l.level > 1 && l.head.next[l.level-1] == nil {
+			l.level--
+		}
+		l.len--
+		return
+	}
+
+	if r.Amount == 0 {
+		return
+	}
+
+	level := l.randomLevel()
+	for i := l.level; i < level; i++ {
+		update[i] = &l.head
+	}
+	if level > l.level {
+		l.level = level
+	}
+
+	n := &levelNode{DepthRecord: r, next: make([]*levelNode, level)}
+	for i := 0; i < level; i++ {
+		n.next[i] = update[i].next[i]
+		update[i].next[i] = n
+	}
+	l.len++
+}
+
+func (l *priceLevels) get(price float64) float64 {
+	x := &l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && l.before(x.next[i].Price, price) {
+			x = x.next[i]
+		}
+	}
+
+	if x = x.next[0]; x != nil && x.Price == price {
+		return x.Amount
+	}
+	return 0
+}
+
+func (l *priceLevels) first() (DepthRecord, bool) {
+	if n := l.head.next[0]; n != nil {
+		return n.DepthRecord, true
+	}
+	return DepthRecord{}, false
+}
+
+func (l *priceLevels) top(n int) DepthRecords {
+	if n <= 0 || n > l.len {
+		n = l.len
+	}
+
+	records := make(DepthRecords, 0, n)
+	for x := l.head.next[0]; x != nil && len(records) < n; x = x.next[0] {
+		records = append(records, x.DepthRecord)
+	}
+	return records
+}
@@ -0,0 +1,248 @@
+package goup
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestOrderBookUpdate(t *testing.T) {
+	asks := DepthRecords{
+		{Price: 0.00015956, Amount: 11.06957197},
+		{Price: 0.00015957, Amount: 6069.4644},
+		{Price: 0.00015959, Amount: 38.80574195},
+		{Price: 0.00015979, Amount: 31374.8668},
+		{Price: 0.0001598, Amount: 20000},
+		{Price: 0.0001606, Amount: 5000},
+		{Price: 0.00016199, Amount: 2136.71},
+	}
+
+	ob := NewOrderBook(NewCurrencyPair("LYM", "ETH"))
+	// bids mirror asks to get a descending side
+	ob.Reset(&Depth{AskList: asks, BidList: asks})
+
+	el := DepthRecord{Price: 0.00018955, Amount: 100}
+	ob.UpdateAsk(el)
+	if d := ob.Depth(); d.AskList[7] != el {
+		t.Errorf("insert failed: %+v", d.AskList)
+	}
+
+	el = DepthRecord{Price: 0.0001598, Amount: 100}
+	ob.UpdateAsk(el)
+	if d := ob.Depth(); d.AskList[4] != el || len(d.AskList) != 8 {
+		t.Errorf("update failed: %+v", d.AskList)
+	}
+
+	el = DepthRecord{Price: 0.0001607, Amount: 100}
+	ob.UpdateBid(el)
+	if d := ob.Depth(); d.BidList[1] != el {
+		t.Errorf("insert failed: %+v", d.BidList)
+	}
+
+	ob.UpdateBid(DepthRecord{Price: 0.00015956, Amount: 0})
+	if _, bids := ob.Len(); bids != 7 {
+		t.Errorf("delete failed, %d bids left", bids)
+	}
+
+	// removing an unknown level is a no-op
+	ob.UpdateBid(DepthRecord{Price: 1, Amount: 0})
+	if _, bids := ob.Len(); bids != 7 {
+		t.Errorf("delete of unknown level changed the book")
+	}
+
+	ask, _ := ob.BestAsk()
+	bid, _ := ob.BestBid()
+	if ask.Price != 0.00015956 || bid.Price != 0.00016199 {
+		t.Errorf("unexpected best levels: %+v %+v", ask, bid)
+	}
+
+	if top := ob.TopN(3); len(top.AskList) != 3 || len(top.BidList) != 3 {
+		t.Errorf("TopN(3) returned %d asks, %d bids", len(top.AskList), len(top.BidList))
+	}
+}
+
+func TestOrderBookSpread(t *testing.T) {
+	ob := NewOrderBook(NewCurrencyPair("LYM", "ETH"))
+	if ob.Spread() != 0 || ob.Mid() != 0 {
+		t.Error("empty book has a spread")
+	}
+
+	ob.Reset(&Depth{
+		AskList: DepthRecords{{Price: 12, Amount: 1}, {Price: 11, Amount: 1}},
+		BidList: DepthRecords{{Price: 8, Amount: 1}, {Price: 9, Amount: 1}},
+	})
+
+	if ob.Spread() != 2 || ob.Mid() != 10 {
+		t.Errorf("spread: %f, mid: %f", ob.Spread(), ob.Mid())
+	}
+}
+
+// TestOrderBookRandom checks the skip lists against a map of levels
+func TestOrderBookRandom(t *testing.T) {
+	ob := NewOrderBook(NewCurrencyPair("LYM", "ETH"))
+	want := map[float64]float64{}
+	r := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 20000; i++ {
+		price := float64(r.Intn(500))
+		amount := float64(r.Intn(3))
+		ob.UpdateAsk(DepthRecord{Price: price, Amount: amount})
+		if amount == 0 {
+			delete(want, price)
+		} else {
+			want[price] = amount
+		}
+	}
+
+	asks := ob.Depth().AskList
+	if len(asks) != len(want) {
+		t.Fatalf("got %d levels, want %d", len(asks), len(want))
+	}
+
+	if !sort.IsSorted(asks) {
+		t.Error("asks are not ascending")
+	}
+
+	for _, ask := range asks {
+		if want[ask.Price] != ask.Amount {
+			t.Errorf("level %f: got %f, want %f", ask.Price, ask.Amount, want[ask.Price])
+		}
+	}
+}
+
+// deltaStream generates updates around a drifting mid price, most of them
+// hitting the top of the book like a real feed, a quarter removing levels.
+func deltaStream(n int) []DepthRecord {
+	r := rand.New(rand.NewSource(42))
+	deltas := make([]DepthRecord, n)
+	mid := 10000
+	for i := range deltas {
+		mid += r.Intn(3) - 1
+		price := float64(mid + int(r.ExpFloat64()*50))
+		amount := 0.0
+		if r.Intn(4) != 0 {
+			amount = float64(r.Intn(1000) + 1)
+		}
+		deltas[i] = DepthRecord{Price: price, Amount: amount}
+	}
+	return deltas
+}
+
+// a seeded book of 2000 levels
+func seedLevels() DepthRecords {
+	var levels DepthRecords
+	for i := 0; i < 2000; i++ {
+		levels = append(levels, DepthRecord{Price: float64(10000 + i), Amount: 1})
+	}
+	return levels
+}
+
+func BenchmarkOrderBookUpdate(b *testing.B) {
+	deltas := deltaStream(1 << 16)
+	ob := NewOrderBook(NewCurrencyPair("LYM", "ETH"))
+	ob.Reset(&Depth{AskList: seedLevels()})
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		ob.UpdateAsk(deltas[i&(len(deltas)-1)])
+	}
+}
+
+// BenchmarkSortedSliceUpdate is the append+copy approach, for comparison
+func BenchmarkSortedSliceUpdate(b *testing.B) {
+	deltas := deltaStream(1 << 16)
+	asks := seedLevels()
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		el := deltas[i&(len(deltas)-1)]
+		index := sort.Search(len(asks), func(i int) bool { return asks[i].Price >= el.Price })
+		if index < len(asks) && asks[index].Price == el.Price {
+			asks[index] = el
+			if el.Amount == 0 {
+				asks = append(asks[:index], asks[index+1:]...)
+			}
+		} else if el.Amount != 0 {
+			asks = append(asks, DepthRecord{})
+			copy(asks[index+1:], asks[index:])
+			asks[index] = el
+		}
+	}
+}
+
+func BenchmarkOrderBookTopN(b *testing.B) {
+	ob := NewOrderBook(NewCurrencyPair("LYM", "ETH"))
+	ob.Reset(&Depth{AskList: seedLevels(), BidList: seedLevels()})
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		ob.TopN(20)
+	}
+}
+
+// TestOrderBooksRace hammers a book from one goroutine while others read
+// snapshots, run it with -race. Every update sets all levels to the same
+// amount, so a torn snapshot has mixed amounts.
+func TestOrderBooksRace(t *testing.T) {
+	pair := NewCurrencyPair("LYM", "ETH")
+	obs := NewOrderBooks()
+	levels := func(amount float64) *Depth {
+		d := &Depth{Pair: pair}
+		for i := 0; i < 50; i++ {
+			d.AskList = append(d.AskList, DepthRecord{Price: float64(100 + i), Amount: amount})
+			d.BidList = append(d.BidList, DepthRecord{Price: float64(99 - i), Amount: amount})
+		}
+		return d
+	}
+	obs.Reset(levels(1))
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				d := obs.Snapshot(pair)
+				for _, r := range append(d.AskList, d.BidList...) {
+					if r.Amount != d.AskList[0].Amount {
+						t.Errorf("torn snapshot: %+v", d)
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	var published []*Depth
+	for i := 2; i < 2000; i++ {
+		d, err := obs.Update(levels(float64(i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		published = append(published, d)
+	}
+	close(done)
+	wg.Wait()
+
+	// snapshots handed out earlier are never modified
+	for i, d := range published {
+		if d.AskList[0].Amount != float64(i+2) {
+			t.Fatalf("snapshot %d was modified: %+v", i, d.AskList[0])
+		}
+	}
+
+	if _, err := obs.Update(&Depth{Pair: NewCurrencyPair("DOCK", "ETH")}); err != ErrNoOrderBook {
+		t.Errorf("got %v, want ErrNoOrderBook", err)
+	}
+}
@@ -0,0 +1,242 @@
+// Package poller emulates websocket streams by polling REST endpoints, for
+// exchanges which don't offer them.
+package poller
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jflyup/goup"
+)
+
+// DefaultDepthSize is the number of levels polled by Client.WsDepth
+const DefaultDepthSize = 30
+
+type (
+	// DepthGetter is the part of goup.API needed to poll depth
+	DepthGetter interface {
+		GetDepth(pair goup.CurrencyPair, size int) (*goup.Depth, error)
+	}
+
+	// TradesGetter is the part of goup.API needed to poll trades
+	TradesGetter interface {
+		GetTrades(pair goup.CurrencyPair, since int64) ([]*goup.Trade, error)
+	}
+
+	// TickerGetter is the part of goup.API needed to poll tickers
+	TickerGetter interface {
+		GetTicker(pair goup.CurrencyPair) (*goup.Ticker, error)
+	}
+
+	// KlinesGetter is the part of goup.API needed to poll klines
+	KlinesGetter interface {
+		GetKlines(pair goup.CurrencyPair, interval goup.KlineInterval, size, since int) ([]*goup.Kline, error)
+	}
+)
+
+// Poller runs polling loops at a fixed interval. Handlers are called from the
+// polling goroutine, a slow handler delays the next poll instead of queueing
+// messages, so the streams are conflated by nature.
+type Poller struct {
+	interval  time.Duration
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// New creates a poller, interval should respect the rate limit of the exchange.
+func New(interval time.Duration) *Poller {
+	return &Poller{
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+}
+
+// Close stops all polling loops
+func (p *Poller) Close() {
+	p.closeOnce.Do(func() {
+		close(p.done)
+	})
+}
+
+// loop calls fn immediately and then every interval until the poller is closed
+func (p *Poller) loop(fn func()) {
+	go func() {
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+
+		for {
+			fn()
+			select {
+			case <-ticker.C:
+			case <-p.done:
+				return
+			}
+		}
+	}()
+}
+
+// Depth polls the order book of pair, handler is called whenever it changes.
+func (p *Poller) Depth(api DepthGetter, pair goup.CurrencyPair, size int, handler func(*goup.Depth)) {
+	var last *goup.Depth
+	p.loop(func() {
+		depth, err := api.GetDepth(pair, size)
+		if err != nil {
+			log.Printf("ERROR\tfailed to poll depth of %s: %v", pair, err)
+			return
+		}
+
+		if last != nil && sameDepth(last, depth) {
+			return
+		}
+
+		if depth.Pair == (goup.CurrencyPair{}) {
+			depth.Pair = pair
+		}
+		last = depth
+		handler(depth)
+	})
+}
+
+// Trades polls recent trades of pair, handler is called with the trades not
+// seen before, oldest first. Trades are identified by Tid, the first poll only
+// primes the seen set since a websocket doesn't replay history either.
+func (p *Poller) Trades(api TradesGetter, pair goup.CurrencyPair, handler func([]*goup.Trade)) {
+	var seen map[int64]bool
+	p.loop(func() {
+		trades, err := api.GetTrades(pair, 0)
+		if err != nil {
+			log.Printf("ERROR\tfailed to poll trades of %s: %v", pair, err)
+			return
+		}
+
+		// a trade can't come back once it left the window of the endpoint,
+		// so only the Tids of the latest response are kept
+		latest := make(map[int64]bool, len(trades))
+		var fresh []*goup.Trade
+		for _, t := range trades {
+			latest[t.Tid] = true
+			if seen != nil && !seen[t.Tid] {
+				fresh = append(fresh, t)
+			}
+		}
+		seen = latest
+
+		if len(fresh) == 0 {
+			return
+		}
+
+		sort.SliceStable(fresh, func(i, j int) bool {
+			return fresh[i].Ts < fresh[j].Ts
+		})
+		handler(fresh)
+	})
+}
+
+// Ticker polls the ticker of pair, handler is called whenever the last price
+// changes.
+func (p *Poller) Ticker(api TickerGetter, pair goup.CurrencyPair, handler func(*goup.Ticker)) {
+	var last float64
+	p.loop(func() {
+		ticker, err := api.GetTicker(pair)
+		if err != nil {
+			log.Printf("ERROR\tfailed to poll ticker of %s: %v", pair, err)
+			return
+		}
+
+		if ticker.Last == last {
+			return
+		}
+
+		last = ticker.Last
+		handler(ticker)
+	})
+}
+
+// Klines polls the latest kline of pair, handler is called whenever it
+// changes, including when a new kline opens.
+func (p *Poller) Klines(api KlinesGetter, pair goup.CurrencyPair, interval goup.KlineInterval, handler func(*goup.Kline)) {
+	var last goup.Kline
+	p.loop(func() {
+		klines, err := api.GetKlines(pair, interval, 1, 0)
+		if err != nil {
+			log.Printf("ERROR\tfailed to poll klines of %s: %v", pair, err)
+			return
+		}
+
+		if len(klines) == 0 {
+			return
+		}
+
+		// exchanges differ in the order of klines, pick the latest one
+		latest := klines[0]
+		for _, k := range klines[1:] {
+			if k.OpenTime > latest.OpenTime {
+				latest = k
+			}
+		}
+
+		if *latest == last {
+			return
+		}
+
+		last = *latest
+		handler(latest)
+	})
+}
+
+func sameDepth(a, b *goup.Depth) bool {
+	return sameRecords(a.AskList, b.AskList) && sameRecords(a.BidList, b.BidList)
+}
+
+func sameRecords(a, b goup.DepthRecords) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Client wraps a goup.API, serving its websocket methods by polling.
+type Client struct {
+	goup.API
+	*Poller
+}
+
+// NewClient wraps api, polling every interval.
+func NewClient(api goup.API, interval time.Duration) *Client {
+	return &Client{
+		API:    api,
+		Poller: New(interval),
+	}
+}
+
+// WsDepth implements the API interface, depth is regrouped here to the tick
+// of goup.WithTick. Polling never queues messages, so backpressure options
+// have no effect.
+func (c *Client) WsDepth(pair goup.CurrencyPair, handler func(*goup.Depth), opts ...goup.SubOption) error {
+	cfg := goup.NewSubConfig(opts...)
+	c.Depth(c.API, pair, DefaultDepthSize, func(d *goup.Depth) {
+		handler(d.Regroup(cfg.Tick))
+	})
+	return nil
+}
+
+// WsTrades implements the API interface
+func (c *Client) WsTrades(pair goup.CurrencyPair, handler func([]*goup.Trade), opts ...goup.SubOption) error {
+	c.Trades(c.API, pair, handler)
+	return nil
+}
+
+// WsKlines implements the API interface
+func (c *Client) WsKlines(pair goup.CurrencyPair, interval goup.KlineInterval, handler func(*goup.Kline), opts ...goup.SubOption) error {
+	c.Klines(c.API, pair, interval, handler)
+	return nil
+}
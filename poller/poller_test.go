@@ -0,0 +1,133 @@
+package poller
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jflyup/goup"
+)
+
+// fakeAPI replays a script of responses, repeating the last one
+type fakeAPI struct {
+	lock   sync.Mutex
+	depths []*goup.Depth
+	trades [][]*goup.Trade
+}
+
+func (f *fakeAPI) GetDepth(pair goup.CurrencyPair, size int) (*goup.Depth, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	d := f.depths[0]
+	if len(f.depths) > 1 {
+		f.depths = f.depths[1:]
+	}
+	return d, nil
+}
+
+func (f *fakeAPI) GetTrades(pair goup.CurrencyPair, since int64) ([]*goup.Trade, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	t := f.trades[0]
+	if len(f.trades) > 1 {
+		f.trades = f.trades[1:]
+	}
+	return t, nil
+}
+
+var pair = goup.NewCurrencyPair("LYM", "ETH")
+
+func TestDepth(t *testing.T) {
+	d1 := &goup.Depth{AskList: goup.DepthRecords{{Price: 2, Amount: 1}}}
+	d2 := &goup.Depth{AskList: goup.DepthRecords{{Price: 2, Amount: 1}}}
+	d3 := &goup.Depth{AskList: goup.DepthRecords{{Price: 2, Amount: 3}}}
+	api := &fakeAPI{depths: []*goup.Depth{d1, d2, d3}}
+
+	p := New(time.Millisecond)
+	defer p.Close()
+
+	ch := make(chan *goup.Depth, 8)
+	p.Depth(api, pair, 10, func(d *goup.Depth) {
+		ch <- d
+	})
+
+	if d := <-ch; d != d1 || d.Pair != pair {
+		t.Errorf("got %+v, want the first depth", d)
+	}
+
+	// d2 equals d1 and is skipped
+	if d := <-ch; d != d3 {
+		t.Errorf("got %+v, want the changed depth", d)
+	}
+
+	select {
+	case d := <-ch:
+		t.Errorf("unexpected depth %+v", d)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+// depthAPI serves the depths of fakeAPI to Client
+type depthAPI struct {
+	goup.API
+	f *fakeAPI
+}
+
+func (d depthAPI) GetDepth(pair goup.CurrencyPair, size int) (*goup.Depth, error) {
+	return d.f.GetDepth(pair, size)
+}
+
+func TestClientDepthTick(t *testing.T) {
+	api := &fakeAPI{depths: []*goup.Depth{{
+		AskList: goup.DepthRecords{{Price: 2.01, Amount: 1}, {Price: 2.04, Amount: 2}},
+		BidList: goup.DepthRecords{{Price: 1.99, Amount: 1}},
+	}}}
+
+	c := NewClient(depthAPI{f: api}, time.Millisecond)
+	defer c.Close()
+
+	ch := make(chan *goup.Depth, 8)
+	c.WsDepth(pair, func(d *goup.Depth) { ch <- d }, goup.WithTick(0.1))
+
+	d := <-ch
+	if len(d.AskList) != 1 || d.AskList[0].Amount != 3 || len(d.BidList) != 1 || d.BidList[0].Price != 1.9 {
+		t.Errorf("got %+v, want regrouped to 0.1", d)
+	}
+}
+
+func TestTrades(t *testing.T) {
+	api := &fakeAPI{trades: [][]*goup.Trade{
+		{{Tid: 2, Ts: 20}, {Tid: 1, Ts: 10}},
+		{{Tid: 4, Ts: 40}, {Tid: 3, Ts: 30}, {Tid: 2, Ts: 20}},
+		{{Tid: 5, Ts: 50}, {Tid: 4, Ts: 40}},
+	}}
+
+	p := New(time.Millisecond)
+	defer p.Close()
+
+	ch := make(chan []*goup.Trade, 8)
+	p.Trades(api, pair, func(trades []*goup.Trade) {
+		ch <- trades
+	})
+
+	var tids []int64
+	for len(tids) < 3 {
+		select {
+		case trades := <-ch:
+			for _, trade := range trades {
+				tids = append(tids, trade.Tid)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timeout, got %v", tids)
+		}
+	}
+
+	want := []int64{3, 4, 5}
+	for i := range want {
+		if tids[i] != want[i] {
+			t.Fatalf("got tids %v, want %v", tids, want)
+		}
+	}
+}
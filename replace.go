@@ -0,0 +1,98 @@
+package goup
+
+import "time"
+
+// Replacement is the outcome of replacing an order
+type Replacement struct {
+	// Old is the final state of the replaced order
+	Old *Order
+	// New is the order resting afterwards, nil if Old filled up to the new
+	// amount in the meantime. With native amend it's Old amended.
+	New *Order
+	// Replaced is the amount actually placed anew, the new amount minus what
+	// Old filled, as the exchange took it after rounding to its precision
+	Replaced float64
+}
+
+// CancelConfirmer is the part of API needed to cancel an order and wait
+// until it's done
+type CancelConfirmer interface {
+	OrderCanceler
+	GetOrder(orderID string, pair CurrencyPair) (*Order, error)
+}
+
+// CancelReplacer is the part of API needed to emulate replacing an order
+type CancelReplacer interface {
+	LimitPlacer
+	CancelConfirmer
+}
+
+// cancel confirmation is polled up to cancelPolls times
+var (
+	cancelPolls    = 5
+	cancelInterval = 200 * time.Millisecond
+)
+
+// CancelConfirm cancels an order and polls it until the exchange confirms
+// it's done, some exchanges cancel asynchronously. The last state read is
+// returned along with ErrCancelPending if it's still not done, or with the
+// error of the cancel. A failed cancel usually means the order finished
+// meanwhile, so it's polled all the same.
+func CancelConfirm(api CancelConfirmer, orderID string, pair CurrencyPair) (*Order, error) {
+	_, cancelErr := api.CancelOrder(orderID, pair)
+
+	var o *Order
+	for i := 0; i < cancelPolls; i++ {
+		if i > 0 {
+			time.Sleep(cancelInterval)
+		}
+
+		var err error
+		if o, err = api.GetOrder(orderID, pair); err != nil {
+			return nil, err
+		}
+
+		if o.Status.Done() {
+			return o, nil
+		}
+	}
+
+	if cancelErr != nil {
+		return o, cancelErr
+	}
+	return o, ErrCancelPending
+}
+
+// CancelReplace replaces an order by canceling it and placing what's left of
+// amount at price, for exchanges without native amend. amount is the total
+// size, the fills of the old order until it's canceled count towards it.
+// Nothing is placed unless the old order is known to be done.
+func CancelReplace(api CancelReplacer, orderID string, pair CurrencyPair, price, amount float64) (*Replacement, error) {
+	// the order may have filled before the cancel, so the final state
+	// is what tells what's left
+	old, err := CancelConfirm(api, orderID, pair)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Replacement{Old: old}
+	remaining := amount - old.DealAmount
+	if remaining <= 0 {
+		return r, nil
+	}
+
+	if old.Side == Buy {
+		r.New, err = api.LimitBuy(remaining, price, pair)
+	} else {
+		r.New, err = api.LimitSell(remaining, price, pair)
+	}
+	if err != nil {
+		return r, err
+	}
+
+	r.Replaced = remaining
+	if r.New != nil && r.New.Amount > 0 {
+		r.Replaced = r.New.Amount
+	}
+	return r, nil
+}
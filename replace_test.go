@@ -0,0 +1,100 @@
+package goup
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+// amender is an exchange whose order fills filled before it's canceled
+type amender struct {
+	order    *Order
+	filled   float64
+	canceled bool
+	placed   []float64
+	// lot is the precision amounts are truncated to, 0 for none
+	lot float64
+}
+
+func (a *amender) LimitBuy(amount, price float64, pair CurrencyPair) (*Order, error) {
+	if a.lot > 0 {
+		amount = math.Floor(amount/a.lot) * a.lot
+	}
+	a.placed = append(a.placed, amount)
+	return &Order{OrderID: "new", Side: Buy, Price: price, Amount: amount}, nil
+}
+
+func (a *amender) LimitSell(amount, price float64, pair CurrencyPair) (*Order, error) {
+	return nil, errors.New("unexpected sell")
+}
+
+func (a *amender) CancelOrder(orderID string, pair CurrencyPair) (bool, error) {
+	if a.filled >= a.order.Amount {
+		return false, errors.New("order not found")
+	}
+	a.canceled = true
+	return true, nil
+}
+
+func (a *amender) GetOrder(orderID string, pair CurrencyPair) (*Order, error) {
+	o := *a.order
+	o.DealAmount = a.filled
+	switch {
+	case a.filled >= o.Amount:
+		o.Status = Filled
+	case a.canceled:
+		o.Status = Canceled
+	}
+	return &o, nil
+}
+
+func TestCancelReplace(t *testing.T) {
+	for _, c := range []struct {
+		filled, amount, replaced float64
+	}{
+		{0, 2, 2},
+		{0.5, 2, 1.5},
+		{1, 1, 0},
+		{1, 3, 2}, // filled before the cancel
+	} {
+		a := &amender{order: &Order{OrderID: "old", Side: Buy, Amount: 1}, filled: c.filled}
+		r, err := CancelReplace(a, "old", CurrencyPair{}, 10, c.amount)
+		if err != nil {
+			t.Errorf("%+v: %v", c, err)
+			continue
+		}
+
+		if r.Replaced != c.replaced || r.Old.DealAmount != c.filled {
+			t.Errorf("%+v: got %+v", c, r)
+		}
+		if (r.New != nil) != (c.replaced > 0) || len(a.placed) > 1 {
+			t.Errorf("%+v: new order %+v, placed %v", c, r.New, a.placed)
+		}
+	}
+}
+
+// TestCancelReplaceTruncated reports what the exchange took, not what was asked
+func TestCancelReplaceTruncated(t *testing.T) {
+	a := &amender{order: &Order{OrderID: "old", Side: Buy, Amount: 1}, filled: 0.25, lot: 0.5}
+	r, err := CancelReplace(a, "old", CurrencyPair{}, 10, 2)
+	if err != nil || r.Replaced != 1.5 || r.New.Amount != 1.5 {
+		t.Errorf("got %+v, %v, want 1.5 replaced", r, err)
+	}
+}
+
+// stuck acknowledges cancels that never take effect
+type stuck struct{ amender }
+
+func (s *stuck) GetOrder(orderID string, pair CurrencyPair) (*Order, error) {
+	return &Order{OrderID: orderID, Status: Canceling}, nil
+}
+
+func TestCancelReplacePending(t *testing.T) {
+	defer func(d time.Duration) { cancelInterval = d }(cancelInterval)
+	cancelInterval = 0
+	s := &stuck{amender{order: &Order{Amount: 1}}}
+	if _, err := CancelReplace(s, "old", CurrencyPair{}, 10, 1); err != ErrCancelPending || len(s.placed) != 0 {
+		t.Errorf("got %v, placed %v", err, s.placed)
+	}
+}
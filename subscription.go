@@ -0,0 +1,71 @@
+package goup
+
+// Backpressure decides what happens to messages when the handler of a
+// websocket subscription can't keep up with the exchange
+type Backpressure int
+
+const (
+	// Block stalls the websocket reader until the handler catches up
+	Block Backpressure = iota
+	// DropNewest discards incoming messages while the buffer is full
+	DropNewest
+	// DropOldest discards the oldest buffered message to make room
+	DropOldest
+	// Conflate keeps only the latest message, suitable for snapshots like depth
+	Conflate
+)
+
+func (b Backpressure) String() string {
+	switch b {
+	case Block:
+		return "block"
+	case DropNewest:
+		return "drop newest"
+	case DropOldest:
+		return "drop oldest"
+	case Conflate:
+		return "conflate"
+	default:
+		return "unknown"
+	}
+}
+
+// SubConfig is the settings of a websocket subscription
+type SubConfig struct {
+	Backpressure Backpressure
+	// Dropped counts the messages discarded by Backpressure if it's not nil,
+	// it's updated atomically so read it with atomic.LoadUint64
+	Dropped *uint64
+	// Tick aggregates depth into price levels of this size, 0 keeps the
+	// finest levels. Exchanges aggregate on their side when they can,
+	// otherwise depth is regrouped locally.
+	Tick float64
+}
+
+// SubOption configures a websocket subscription
+type SubOption func(*SubConfig)
+
+// WithBackpressure sets the policy of a subscription, dropped may be nil
+func WithBackpressure(b Backpressure, dropped *uint64) SubOption {
+	return func(c *SubConfig) {
+		c.Backpressure = b
+		c.Dropped = dropped
+	}
+}
+
+// WithTick requests depth aggregated into price levels of tick size
+func WithTick(tick float64) SubOption {
+	return func(c *SubConfig) {
+		c.Tick = tick
+	}
+}
+
+// NewSubConfig applies opts on the default settings
+func NewSubConfig(opts ...SubOption) *SubConfig {
+	c := &SubConfig{Backpressure: Block}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
@@ -0,0 +1,91 @@
+package trigger
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+)
+
+// extremeSaveInterval is how long moved trailing extremes may go unsaved,
+// they move with every trade
+var extremeSaveInterval = time.Second
+
+// load reads the triggers stored at path, a missing file holds none
+func load(path string) ([]*Trigger, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var triggers []*Trigger
+	if err := json.Unmarshal(data, &triggers); err != nil {
+		return nil, err
+	}
+
+	return triggers, nil
+}
+
+// save writes the triggers to the store if any, the file is replaced
+// atomically so a crash leaves either the old or the new set. The caller
+// holds lock.
+func (e *Engine) save() error {
+	if e.path == "" {
+		return nil
+	}
+
+	triggers := make([]*Trigger, 0, len(e.triggers)+len(e.parked))
+	triggers = append(triggers, e.parked...)
+	for _, t := range e.triggers {
+		triggers = append(triggers, t)
+	}
+
+	data, err := json.Marshal(triggers)
+	if err != nil {
+		return err
+	}
+
+	tmp := e.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, e.path)
+}
+
+// saveLater saves the triggers within extremeSaveInterval, a crash meanwhile
+// only loses how far trails moved. The caller holds lock.
+func (e *Engine) saveLater() {
+	if e.path == "" || e.saveTimer != nil {
+		return
+	}
+
+	e.saveTimer = time.AfterFunc(extremeSaveInterval, func() {
+		e.lock.Lock()
+		defer e.lock.Unlock()
+
+		e.saveTimer = nil
+		if err := e.save(); err != nil {
+			log.Printf("ERROR\tfailed to save triggers: %v", err)
+		}
+	})
+}
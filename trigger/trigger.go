@@ -0,0 +1,417 @@
+// Package trigger emulates stop-loss, trailing stop and take-profit orders on
+// the client, an order is placed once the price of a pair crosses the level
+// of a trigger.
+package trigger
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jflyup/goup"
+	"github.com/jflyup/goup/poller"
+	"github.com/jflyup/goup/util"
+)
+
+var (
+	ErrUnknownExchange = errors.New("unknown exchange")
+	ErrUnknownTrigger  = errors.New("unknown trigger")
+	ErrInvalidTrigger  = errors.New("invalid trigger")
+)
+
+// Kind tells which way a trigger fires relative to the side of its order
+type Kind int
+
+const (
+	// StopLoss fires when the price moves against the position the order
+	// closes, a sell below Level or a buy above it
+	StopLoss Kind = iota
+	// TakeProfit fires when the price moves in favor of the position, a sell
+	// above Level or a buy below it
+	TakeProfit
+	// TrailingStop is a stop loss whose Level follows the price at a distance
+	// of Trail as the price moves in favor of the position
+	TrailingStop
+)
+
+func (k Kind) String() string {
+	switch k {
+	case StopLoss:
+		return "stop loss"
+	case TakeProfit:
+		return "take profit"
+	case TrailingStop:
+		return "trailing stop"
+	default:
+		return "unknown"
+	}
+}
+
+// Trigger is an order held back until the price crosses Level
+type Trigger struct {
+	ID       string
+	Exchange string
+	Pair     goup.CurrencyPair
+	Kind     Kind
+	// Side is the side of the order placed
+	Side  goup.TradeSide
+	Level float64
+	// Price is the price of the limit order placed, 0 places a market order
+	Price float64
+	// Amount is in base currency, except for market buys where it's in quote
+	// currency like goup.API.MarketBuy
+	Amount float64
+	// Trail is the distance of Level from Extreme for a TrailingStop, in
+	// percent of Extreme if TrailPercent is set
+	Trail        float64
+	TrailPercent bool
+	// Extreme is the best price seen by a TrailingStop, the high for a sell
+	// and the low for a buy. Level is derived from it, 0 until a price is seen.
+	Extreme float64
+	Created int64
+}
+
+func (t *Trigger) valid() bool {
+	if t.Amount <= 0 || t.Price < 0 {
+		return false
+	}
+
+	if t.Kind == TrailingStop {
+		return t.Trail > 0 && !(t.TrailPercent && t.Trail >= 100)
+	}
+
+	return t.Level > 0
+}
+
+// trail moves the level of a trailing stop after price, it reports whether
+// the level moved
+func (t *Trigger) trail(price float64) bool {
+	if t.Kind != TrailingStop {
+		return false
+	}
+
+	if t.Extreme != 0 && (t.Side == goup.Sell && price <= t.Extreme || t.Side == goup.Buy && price >= t.Extreme) {
+		return false
+	}
+
+	t.Extreme = price
+	d := t.Trail
+	if t.TrailPercent {
+		d = price * t.Trail / 100
+	}
+
+	if t.Side == goup.Sell {
+		t.Level = price - d
+	} else {
+		t.Level = price + d
+	}
+	return true
+}
+
+// fires reports whether price crossed the level of t
+func (t *Trigger) fires(price float64) bool {
+	// sell stops and buy take-profits fire on the way down
+	if (t.Kind != TakeProfit) == (t.Side == goup.Sell) {
+		return price <= t.Level
+	}
+
+	return price >= t.Level
+}
+
+// Activation is a trigger which fired, Order is what was placed
+type Activation struct {
+	Trigger Trigger
+	// Price is the price which crossed the level
+	Price float64
+	Order *goup.Order
+	// Err is why placing the order failed
+	Err error
+}
+
+const activationTopic = "activations"
+
+// Engine watches the prices of the pairs with armed triggers, via WsTrades
+// or by polling GetTicker when the exchange has no trade stream. A trigger
+// fires at most once, it's disarmed before its order is placed. It's safe
+// for concurrent use.
+type Engine struct {
+	apis     map[string]goup.API
+	lock     sync.Mutex
+	triggers map[string]*Trigger
+	// parked are stored triggers on unknown exchanges, kept but never armed
+	parked []*Trigger
+	// watched is keyed by exchange and pair
+	watched map[string]bool
+	path    string
+	poller  *poller.Poller
+	// saveTimer is pending while moved extremes aren't saved yet
+	saveTimer *time.Timer
+	// closed is read under pubLock before publishing, an activation racing
+	// with Close is dropped
+	pubLock sync.RWMutex
+	pubsub  *util.PubSub
+	closed  bool
+}
+
+// New creates an engine for triggers on apis, interval is how often tickers
+// are polled for exchanges without WsTrades.
+func New(interval time.Duration, apis ...goup.API) *Engine {
+	e := &Engine{
+		apis:     make(map[string]goup.API),
+		triggers: make(map[string]*Trigger),
+		watched:  make(map[string]bool),
+		poller:   poller.New(interval),
+		pubsub:   util.NewPubSub(64),
+	}
+
+	for _, api := range apis {
+		e.apis[api.ExchangeName()] = api
+	}
+
+	return e
+}
+
+// SetStore persists the armed triggers to the file at path. The triggers
+// already stored there are loaded and armed again, call it on startup. Those
+// on exchanges the engine wasn't created with stay in the store unarmed.
+func (e *Engine) SetStore(path string) error {
+	triggers, err := load(path)
+	if err != nil {
+		return err
+	}
+
+	var armed []*Trigger
+	e.lock.Lock()
+	e.path = path
+	for _, t := range triggers {
+		if _, ok := e.apis[t.Exchange]; !ok {
+			log.Printf("ERROR\ttrigger %s is on unknown exchange %s, not armed", t.ID, t.Exchange)
+			e.parked = append(e.parked, t)
+			continue
+		}
+		e.triggers[t.ID] = t
+		armed = append(armed, t)
+	}
+	err = e.save()
+	e.lock.Unlock()
+
+	for _, t := range armed {
+		e.watch(t.Exchange, t.Pair)
+	}
+
+	return err
+}
+
+// Close stops polling and closes activation subscriptions, streams of
+// trades can't be unsubscribed and are ignored from then on.
+func (e *Engine) Close() {
+	e.pubLock.Lock()
+	defer e.pubLock.Unlock()
+
+	if e.closed {
+		return
+	}
+
+	e.closed = true
+	e.poller.Close()
+	e.pubsub.Shutdown()
+
+	e.lock.Lock()
+	if e.saveTimer != nil && e.saveTimer.Stop() {
+		e.saveTimer = nil
+		if err := e.save(); err != nil {
+			log.Printf("ERROR\tfailed to save triggers: %v", err)
+		}
+	}
+	e.lock.Unlock()
+}
+
+// Subscribe hands every activation to handler, opts set the backpressure
+func (e *Engine) Subscribe(handler func(*Activation), opts ...goup.SubOption) {
+	e.pubLock.RLock()
+	defer e.pubLock.RUnlock()
+
+	if e.closed {
+		return
+	}
+
+	cfg := goup.NewSubConfig(opts...)
+	ch := e.pubsub.SubWithPolicy(cfg.Backpressure, cfg.Dropped, activationTopic)
+	go func() {
+		for a := range ch {
+			handler(a.(*Activation))
+		}
+	}()
+}
+
+// Arm stores t and starts watching its pair, the armed trigger with its ID
+// is returned.
+func (e *Engine) Arm(t Trigger) (*Trigger, error) {
+	if _, ok := e.apis[t.Exchange]; !ok {
+		return nil, ErrUnknownExchange
+	}
+
+	if !t.valid() {
+		return nil, ErrInvalidTrigger
+	}
+
+	if t.Kind == TrailingStop {
+		t.Level, t.Extreme = 0, 0
+	}
+
+	t.ID = util.NewID()
+	t.Created = util.NowMs()
+
+	e.lock.Lock()
+	e.triggers[t.ID] = &t
+	err := e.save()
+	e.lock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	e.watch(t.Exchange, t.Pair)
+	return &t, nil
+}
+
+// Disarm removes a trigger which hasn't fired yet
+func (e *Engine) Disarm(id string) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if _, ok := e.triggers[id]; !ok {
+		return ErrUnknownTrigger
+	}
+
+	delete(e.triggers, id)
+	return e.save()
+}
+
+// Triggers returns the armed triggers, oldest first
+func (e *Engine) Triggers() []Trigger {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	triggers := make([]Trigger, 0, len(e.triggers))
+	for _, t := range e.triggers {
+		triggers = append(triggers, *t)
+	}
+
+	sort.Slice(triggers, func(i, j int) bool {
+		if triggers[i].Created == triggers[j].Created {
+			return triggers[i].ID < triggers[j].ID
+		}
+		return triggers[i].Created < triggers[j].Created
+	})
+	return triggers
+}
+
+// Observe fires the triggers of pair crossed by price, prices come from the
+// watched streams but may be fed from elsewhere too.
+func (e *Engine) Observe(exchange string, pair goup.CurrencyPair, price float64) {
+	if price <= 0 {
+		return
+	}
+
+	// streams can't be unsubscribed, what they still bring is ignored
+	e.pubLock.RLock()
+	closed := e.closed
+	e.pubLock.RUnlock()
+	if closed {
+		return
+	}
+
+	e.lock.Lock()
+	var fired []*Trigger
+	moved := false
+	for id, t := range e.triggers {
+		if t.Exchange != exchange || t.Pair != pair {
+			continue
+		}
+
+		// a new extreme can't breach the trail it sets
+		if t.trail(price) {
+			moved = true
+			continue
+		}
+
+		if t.fires(price) {
+			fired = append(fired, t)
+			delete(e.triggers, id)
+		}
+	}
+
+	if len(fired) == 0 {
+		if moved {
+			e.saveLater()
+		}
+		e.lock.Unlock()
+		return
+	}
+
+	// a crash after this point loses the triggers rather than placing
+	// their orders twice
+	if err := e.save(); err != nil {
+		log.Printf("ERROR\tfailed to save triggers: %v", err)
+	}
+	e.lock.Unlock()
+
+	for _, t := range fired {
+		e.fire(t, price)
+	}
+}
+
+func (e *Engine) fire(t *Trigger, price float64) {
+	api := e.apis[t.Exchange]
+	a := &Activation{Trigger: *t, Price: price}
+	switch {
+	case api == nil:
+		a.Err = ErrUnknownExchange
+	case t.Price == 0 && t.Side == goup.Buy:
+		a.Order, a.Err = api.MarketBuy(t.Amount, 0, t.Pair)
+	case t.Price == 0:
+		a.Order, a.Err = api.MarketSell(t.Amount, 0, t.Pair)
+	case t.Side == goup.Buy:
+		a.Order, a.Err = api.LimitBuy(t.Amount, t.Price, t.Pair)
+	default:
+		a.Order, a.Err = api.LimitSell(t.Amount, t.Price, t.Pair)
+	}
+
+	if a.Err != nil {
+		log.Printf("ERROR\tfailed to place order of %s trigger %s on %s: %v", t.Kind, t.ID, t.Exchange, a.Err)
+	}
+
+	e.pubLock.RLock()
+	defer e.pubLock.RUnlock()
+
+	if !e.closed {
+		e.pubsub.Pub(a, activationTopic)
+	}
+}
+
+// watch subscribes to the price of pair once, exchange must be known
+func (e *Engine) watch(exchange string, pair goup.CurrencyPair) {
+	api := e.apis[exchange]
+	k := exchange + "/" + pair.String()
+	e.lock.Lock()
+	if e.watched[k] {
+		e.lock.Unlock()
+		return
+	}
+	e.watched[k] = true
+	e.lock.Unlock()
+
+	err := api.WsTrades(pair, func(trades []*goup.Trade) {
+		for _, t := range trades {
+			e.Observe(exchange, pair, t.Price)
+		}
+	})
+	if err != nil {
+		log.Printf("ERROR\tno trade stream of %s on %s, polling ticker: %v", pair, exchange, err)
+		e.poller.Ticker(api, pair, func(t *goup.Ticker) {
+			e.Observe(exchange, pair, t.Last)
+		})
+	}
+}
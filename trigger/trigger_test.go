@@ -0,0 +1,332 @@
+package trigger
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jflyup/goup"
+)
+
+// fakeExchange streams trades through handler, or serves ticker when it has
+// no stream
+type fakeExchange struct {
+	goup.API
+	lock     sync.Mutex
+	noStream bool
+	handler  func([]*goup.Trade)
+	ticker   goup.Ticker
+	orders   []goup.Order
+}
+
+func (f *fakeExchange) ExchangeName() string {
+	return "fake"
+}
+
+func (f *fakeExchange) WsTrades(pair goup.CurrencyPair, handler func([]*goup.Trade), opts ...goup.SubOption) error {
+	if f.noStream {
+		return errors.New("unsupported")
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.handler = handler
+	return nil
+}
+
+func (f *fakeExchange) GetTicker(pair goup.CurrencyPair) (*goup.Ticker, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	t := f.ticker
+	return &t, nil
+}
+
+func (f *fakeExchange) trade(price float64) {
+	f.lock.Lock()
+	handler := f.handler
+	f.lock.Unlock()
+	handler([]*goup.Trade{{Price: price}})
+}
+
+func (f *fakeExchange) place(side goup.TradeSide, amount, price float64) (*goup.Order, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	o := goup.Order{OrderID: "1", Side: side, Price: price, Amount: amount}
+	f.orders = append(f.orders, o)
+	return &o, nil
+}
+
+func (f *fakeExchange) LimitBuy(amount, price float64, pair goup.CurrencyPair) (*goup.Order, error) {
+	return f.place(goup.Buy, amount, price)
+}
+
+func (f *fakeExchange) LimitSell(amount, price float64, pair goup.CurrencyPair) (*goup.Order, error) {
+	return f.place(goup.Sell, amount, price)
+}
+
+func (f *fakeExchange) MarketBuy(amount, price float64, pair goup.CurrencyPair) (*goup.Order, error) {
+	return f.place(goup.Buy, amount, 0)
+}
+
+func (f *fakeExchange) MarketSell(amount, price float64, pair goup.CurrencyPair) (*goup.Order, error) {
+	return f.place(goup.Sell, amount, 0)
+}
+
+var pair = goup.NewCurrencyPair("ETH", "BTC")
+
+func expect(t *testing.T, ch chan *Activation, kind Kind, price float64) *Activation {
+	t.Helper()
+	select {
+	case a := <-ch:
+		if a.Trigger.Kind != kind || a.Price != price || a.Err != nil || a.Order == nil {
+			t.Errorf("got %+v, want %s at %v", a, kind, price)
+		}
+		return a
+	case <-time.After(time.Second):
+		t.Fatalf("no activation, want %s at %v", kind, price)
+		return nil
+	}
+}
+
+func TestEngine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trigger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "triggers.json")
+
+	f := &fakeExchange{}
+	e := New(time.Second, f)
+	defer e.Close()
+	if err := e.SetStore(path); err != nil {
+		t.Fatal(err)
+	}
+
+	ch := make(chan *Activation, 8)
+	e.Subscribe(func(a *Activation) { ch <- a })
+
+	if _, err := e.Arm(Trigger{Exchange: "fake", Pair: pair, Kind: StopLoss, Side: goup.Sell, Level: 90, Amount: 1}); err != nil {
+		t.Fatal(err)
+	}
+	tp, err := e.Arm(Trigger{Exchange: "fake", Pair: pair, Kind: TakeProfit, Side: goup.Sell, Level: 110, Price: 109, Amount: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Arm(Trigger{Exchange: "none", Pair: pair, Level: 1, Amount: 1}); err != ErrUnknownExchange {
+		t.Errorf("got %v, want ErrUnknownExchange", err)
+	}
+
+	f.trade(100)
+	f.trade(89)
+	a := expect(t, ch, StopLoss, 89)
+	if a.Order.Price != 0 || a.Order.Amount != 1 {
+		t.Errorf("stop loss placed %+v, want a market sell of 1", a.Order)
+	}
+
+	// fired triggers are gone, the take profit survives a restart
+	f.trade(80)
+	e2 := New(time.Second, f)
+	defer e2.Close()
+	if err := e2.SetStore(path); err != nil {
+		t.Fatal(err)
+	}
+	if triggers := e2.Triggers(); len(triggers) != 1 || triggers[0] != *tp {
+		t.Fatalf("got %+v, want %+v", triggers, tp)
+	}
+
+	ch2 := make(chan *Activation, 8)
+	e2.Subscribe(func(a *Activation) { ch2 <- a })
+	f.trade(111)
+	if a := expect(t, ch2, TakeProfit, 111); a.Order.Price != 109 || a.Order.Amount != 2 {
+		t.Errorf("take profit placed %+v", a.Order)
+	}
+
+	if len(e2.Triggers()) != 0 || len(f.orders) != 2 {
+		t.Errorf("triggers %+v, orders %+v", e2.Triggers(), f.orders)
+	}
+}
+
+func TestEnginePolling(t *testing.T) {
+	f := &fakeExchange{noStream: true, ticker: goup.Ticker{Last: 100}}
+	e := New(time.Millisecond, f)
+	defer e.Close()
+
+	ch := make(chan *Activation, 8)
+	e.Subscribe(func(a *Activation) { ch <- a })
+
+	// a buy stop fires on the way up
+	if _, err := e.Arm(Trigger{Exchange: "fake", Pair: pair, Kind: StopLoss, Side: goup.Buy, Level: 105, Price: 106, Amount: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	f.lock.Lock()
+	f.ticker.Last = 105
+	f.lock.Unlock()
+	expect(t, ch, StopLoss, 105)
+}
+
+func TestTrailingStop(t *testing.T) {
+	f := &fakeExchange{}
+	e := New(time.Second, f)
+	defer e.Close()
+
+	ch := make(chan *Activation, 8)
+	e.Subscribe(func(a *Activation) { ch <- a })
+
+	if _, err := e.Arm(Trigger{Exchange: "fake", Pair: pair, Kind: TrailingStop, Side: goup.Sell, Amount: 1}); err != ErrInvalidTrigger {
+		t.Errorf("got %v, want ErrInvalidTrigger without trail", err)
+	}
+
+	for _, table := range []struct {
+		side         goup.TradeSide
+		trail        float64
+		percent      bool
+		prices       []float64
+		level, worst float64
+		breach       float64
+	}{
+		{goup.Sell, 10, true, []float64{100, 120, 110}, 108, 120, 107},
+		{goup.Buy, 5, false, []float64{100, 96, 100}, 101, 96, 101},
+	} {
+		if _, err := e.Arm(Trigger{Exchange: "fake", Pair: pair, Kind: TrailingStop, Side: table.side, Trail: table.trail, TrailPercent: table.percent, Amount: 1}); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, price := range table.prices {
+			e.Observe("fake", pair, price)
+		}
+		if triggers := e.Triggers(); len(triggers) != 1 || triggers[0].Level != table.level || triggers[0].Extreme != table.worst {
+			t.Errorf("%s: got %+v, want level %v", table.side, triggers, table.level)
+		}
+
+		e.Observe("fake", pair, table.breach)
+		if a := expect(t, ch, TrailingStop, table.breach); a.Trigger.Side != table.side {
+			t.Errorf("%s: got %+v", table.side, a)
+		}
+		if triggers := e.Triggers(); len(triggers) != 0 {
+			t.Errorf("%s: left %+v", table.side, triggers)
+		}
+	}
+}
+
+// TestUnknownExchange checks that stored triggers on exchanges the engine
+// doesn't have are kept but never armed
+func TestUnknownExchange(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trigger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "triggers.json")
+
+	stored := []Trigger{{ID: "1", Exchange: "none", Pair: pair, Kind: StopLoss, Side: goup.Sell, Level: 90, Amount: 1}}
+	data, _ := json.Marshal(stored)
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fakeExchange{}
+	e := New(time.Second, f)
+	defer e.Close()
+	if err := e.SetStore(path); err != nil {
+		t.Fatal(err)
+	}
+	if triggers := e.Triggers(); len(triggers) != 0 {
+		t.Errorf("got %+v, want none armed", triggers)
+	}
+
+	ch := make(chan *Activation, 8)
+	e.Subscribe(func(a *Activation) { ch <- a })
+	e.Observe("none", pair, 80)
+
+	// nothing can be placed without the exchange
+	e.fire(&stored[0], 80)
+	select {
+	case a := <-ch:
+		if a.Err != ErrUnknownExchange || a.Order != nil {
+			t.Errorf("got %+v, want ErrUnknownExchange", a)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no activation")
+	}
+
+	if _, err := e.Arm(Trigger{Exchange: "fake", Pair: pair, Kind: StopLoss, Side: goup.Sell, Level: 90, Amount: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if triggers, err := load(path); err != nil || len(triggers) != 2 {
+		t.Errorf("stored %+v, %v, want the unknown one kept", triggers, err)
+	}
+	if len(f.orders) != 0 {
+		t.Errorf("placed %+v", f.orders)
+	}
+}
+
+// TestTrailingStopStore checks that moved extremes are saved late, and on Close
+func TestTrailingStopStore(t *testing.T) {
+	defer func(d time.Duration) { extremeSaveInterval = d }(extremeSaveInterval)
+	extremeSaveInterval = 20 * time.Millisecond
+
+	dir, err := ioutil.TempDir("", "trigger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "triggers.json")
+
+	e := New(time.Second, &fakeExchange{})
+	if err := e.SetStore(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Arm(Trigger{Exchange: "fake", Pair: pair, Kind: TrailingStop, Side: goup.Sell, Trail: 10, Amount: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	extreme := func() float64 {
+		triggers, err := load(path)
+		if err != nil || len(triggers) != 1 {
+			t.Fatalf("stored %+v, %v", triggers, err)
+		}
+		return triggers[0].Extreme
+	}
+
+	e.Observe("fake", pair, 100)
+	if got := extreme(); got != 0 {
+		t.Errorf("extreme %v saved at once", got)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for extreme() != 100 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := extreme(); got != 100 {
+		t.Errorf("extreme %v, want 100 saved", got)
+	}
+
+	extremeSaveInterval = time.Hour
+	e.Observe("fake", pair, 120)
+	e.Close()
+	if got := extreme(); got != 120 {
+		t.Errorf("extreme %v, want 120 saved on Close", got)
+	}
+}
+
+func TestObserveClosed(t *testing.T) {
+	f := &fakeExchange{}
+	e := New(time.Second, f)
+	if _, err := e.Arm(Trigger{Exchange: "fake", Pair: pair, Kind: StopLoss, Side: goup.Sell, Level: 90, Amount: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	e.Close()
+	f.trade(80)
+	if len(f.orders) != 0 || len(e.Triggers()) != 1 {
+		t.Errorf("placed %+v after Close, armed %+v", f.orders, e.Triggers())
+	}
+}
@@ -0,0 +1,96 @@
+package util
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/gorilla/websocket"
+)
+
+// Compression is the way an exchange compresses websocket payloads
+type Compression int
+
+const (
+	NoCompression Compression = iota
+	// Gzip compresses every binary frame with gzip, e.g. huobi
+	Gzip
+	// Deflate compresses every binary frame with raw deflate(RFC 1951), e.g. okex
+	Deflate
+	// PerMessageDeflate negotiates the permessage-deflate extension(RFC 7692)
+	// on the handshake, frames are inflated by the websocket library
+	PerMessageDeflate
+)
+
+func (c Compression) String() string {
+	switch c {
+	case NoCompression:
+		return "none"
+	case Gzip:
+		return "gzip"
+	case Deflate:
+		return "deflate"
+	case PerMessageDeflate:
+		return "permessage-deflate"
+	default:
+		return "unknown"
+	}
+}
+
+// decoder inflates per-frame compressed payloads, the readers are reused
+// between frames so it's not safe for concurrent use.
+type decoder struct {
+	compression Compression
+	gz          *gzip.Reader
+	fl          io.ReadCloser
+	src         bytes.Reader
+	dst         bytes.Buffer
+}
+
+func newDecoder(c Compression) *decoder {
+	return &decoder{compression: c}
+}
+
+// decode returns the plain payload of a frame, text frames are never compressed.
+func (d *decoder) decode(messageType int, data []byte) ([]byte, error) {
+	if messageType != websocket.BinaryMessage {
+		return data, nil
+	}
+
+	d.src.Reset(data)
+	var r io.Reader
+	switch d.compression {
+	case Gzip:
+		if d.gz == nil {
+			gz, err := gzip.NewReader(&d.src)
+			if err != nil {
+				return nil, err
+			}
+			d.gz = gz
+		} else if err := d.gz.Reset(&d.src); err != nil {
+			return nil, err
+		}
+		r = d.gz
+	case Deflate:
+		if d.fl == nil {
+			d.fl = flate.NewReader(&d.src)
+		} else if err := d.fl.(flate.Resetter).Reset(&d.src, nil); err != nil {
+			return nil, err
+		}
+		r = d.fl
+	default:
+		return data, nil
+	}
+
+	d.dst.Reset()
+	if _, err := d.dst.ReadFrom(r); err != nil {
+		return nil, fmt.Errorf("failed to inflate %s frame: %v", d.compression, err)
+	}
+
+	// the buffer is reused, hand out a copy
+	plain := make([]byte, d.dst.Len())
+	copy(plain, d.dst.Bytes())
+	return plain, nil
+}
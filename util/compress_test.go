@@ -0,0 +1,94 @@
+package util
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// a depth update of ~60 levels, close to what exchanges push
+var samplePayload = func() []byte {
+	var levels []string
+	for i := 0; i < 60; i++ {
+		levels = append(levels, fmt.Sprintf(`["0.000%05d","%d.1234"]`, 15900+i, 1000+i))
+	}
+	return []byte(`{"method":"depth.update","params":[false,{"asks":[` + strings.Join(levels, ",") + `]},"LYM_ETH"]}`)
+}()
+
+func compress(t testing.TB, c Compression, data []byte) []byte {
+	var buf bytes.Buffer
+	switch c {
+	case Gzip:
+		w := gzip.NewWriter(&buf)
+		w.Write(data)
+		w.Close()
+	case Deflate:
+		w, err := flate.NewWriter(&buf, flate.DefaultCompression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(data)
+		w.Close()
+	default:
+		return data
+	}
+
+	return buf.Bytes()
+}
+
+func TestDecode(t *testing.T) {
+	for _, c := range []Compression{NoCompression, Gzip, Deflate, PerMessageDeflate} {
+		dec := newDecoder(c)
+		// decode twice to exercise reader reuse
+		for i := 0; i < 2; i++ {
+			plain, err := dec.decode(websocket.BinaryMessage, compress(t, c, samplePayload))
+			if err != nil {
+				t.Fatalf("%s: %v", c, err)
+			}
+
+			if !bytes.Equal(plain, samplePayload) {
+				t.Errorf("%s: payload mismatch", c)
+			}
+		}
+
+		// text frames are left alone
+		if plain, err := dec.decode(websocket.TextMessage, samplePayload); err != nil || !bytes.Equal(plain, samplePayload) {
+			t.Errorf("%s: text frame changed, err: %v", c, err)
+		}
+	}
+
+	if _, err := newDecoder(Gzip).decode(websocket.BinaryMessage, samplePayload); err == nil {
+		t.Error("corrupted gzip frame decoded")
+	}
+}
+
+func benchmarkDecode(b *testing.B, c Compression) {
+	frame := compress(b, c, samplePayload)
+	dec := newDecoder(c)
+	b.SetBytes(int64(len(samplePayload)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := dec.decode(websocket.BinaryMessage, frame); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeGzip(b *testing.B) {
+	benchmarkDecode(b, Gzip)
+}
+
+func BenchmarkDecodeDeflate(b *testing.B) {
+	benchmarkDecode(b, Deflate)
+}
+
+func BenchmarkDecodePlain(b *testing.B) {
+	benchmarkDecode(b, NoCompression)
+}
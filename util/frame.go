@@ -0,0 +1,74 @@
+package util
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// FrameDirection tells whether a websocket frame was sent or received
+type FrameDirection int
+
+const (
+	Inbound FrameDirection = iota
+	Outbound
+)
+
+func (d FrameDirection) String() string {
+	switch d {
+	case Inbound:
+		return "in"
+	case Outbound:
+		return "out"
+	default:
+		return "unknown"
+	}
+}
+
+// Frame is a raw websocket frame seen by a WsPool
+type Frame struct {
+	Direction FrameDirection `json:"dir"`
+	Time      time.Time      `json:"ts"`
+	ConnID    int            `json:"conn"`
+	// Binary is set for binary frames, Data is kept as it was on the wire
+	Binary bool   `json:"binary,omitempty"`
+	Data   []byte `json:"data"`
+}
+
+// FrameRecorder writes frames to w as JSON lines, its Record method can be
+// used as the tap of a WsPool to capture a session into a file.
+type FrameRecorder struct {
+	lock sync.Mutex
+	enc  *json.Encoder
+}
+
+// NewFrameRecorder creates a recorder writing to w
+func NewFrameRecorder(w io.Writer) *FrameRecorder {
+	return &FrameRecorder{enc: json.NewEncoder(w)}
+}
+
+// Record writes a single frame, it's safe for concurrent use.
+func (r *FrameRecorder) Record(f *Frame) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.enc.Encode(f)
+}
+
+// ReadFrames decodes frames captured by a FrameRecorder, calling fn for each
+// of them in order.
+func ReadFrames(r io.Reader, fn func(*Frame)) error {
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for {
+		f := &Frame{}
+		if err := dec.Decode(f); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		fn(f)
+	}
+}
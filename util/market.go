@@ -0,0 +1,110 @@
+package util
+
+import (
+	"time"
+
+	"github.com/jflyup/goup"
+	"github.com/jflyup/goup/analytics"
+)
+
+// MarketTrader is the part of goup.API needed to emulate market orders
+type MarketTrader interface {
+	goup.LimitPlacer
+	goup.CancelConfirmer
+	GetDepth(pair goup.CurrencyPair, size int) (*goup.Depth, error)
+}
+
+// DefaultMaxSlippage is the slippage cap of emulated market orders unless
+// the client is told otherwise
+const DefaultMaxSlippage = 0.01
+
+var (
+	// levels read to price an emulated market order
+	marketDepth = 50
+	// how long an emulated market order rests before the remainder is
+	// canceled
+	marketWait = 500 * time.Millisecond
+)
+
+// MarketBuy emulates a market order spending amount of quote currency, like
+// CalcBuyPrice. The limit price is the worst ask needed, at most slippage (a
+// fraction of the best ask) above it and at most limit if it's positive. What's unfilled
+// after a short while is canceled, the final state of the order is returned.
+func MarketBuy(api MarketTrader, amount, limit, slippage float64, pair goup.CurrencyPair) (*goup.Order, error) {
+	return marketOrder(api, goup.Buy, amount, limit, slippage, pair)
+}
+
+// MarketSell emulates a market order selling amount of base currency, like
+// CalcSellPrice, see MarketBuy
+func MarketSell(api MarketTrader, amount, limit, slippage float64, pair goup.CurrencyPair) (*goup.Order, error) {
+	return marketOrder(api, goup.Sell, amount, limit, slippage, pair)
+}
+
+func marketOrder(api MarketTrader, side goup.TradeSide, amount, limit, slippage float64, pair goup.CurrencyPair) (*goup.Order, error) {
+	depth, err := api.GetDepth(pair, marketDepth)
+	if err != nil {
+		return nil, err
+	}
+
+	levels := depth.AskList
+	if side == goup.Sell {
+		levels = depth.BidList
+	}
+	if len(levels) == 0 {
+		return nil, goup.ErrNoLiquidity
+	}
+
+	bound := levels[0].Price * (1 + slippage)
+	if side == goup.Sell {
+		bound = levels[0].Price * (1 - slippage)
+	}
+	if limit > 0 && (side == goup.Buy && limit < bound || side == goup.Sell && limit > bound) {
+		bound = limit
+	}
+
+	// only what's within bound is taken, the rest would be canceled anyway
+	n := 0
+	for n < len(levels) && (side == goup.Buy && levels[n].Price <= bound || side == goup.Sell && levels[n].Price >= bound) {
+		n++
+	}
+
+	var e *analytics.Execution
+	if side == goup.Buy {
+		e = analytics.EstimateBuy(levels[:n], amount, analytics.Quote)
+	} else {
+		e = analytics.EstimateSell(levels[:n], amount, analytics.Base)
+	}
+	if e.Filled == 0 {
+		return nil, goup.ErrNoLiquidity
+	}
+
+	var order *goup.Order
+	if side == goup.Buy {
+		order, err = api.LimitBuy(e.Filled, e.WorstPrice, pair)
+	} else {
+		order, err = api.LimitSell(e.Filled, e.WorstPrice, pair)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	time.Sleep(marketWait)
+	return CancelRemainder(api, order, pair)
+}
+
+// CancelRemainder cancels what's left of order and returns its final state,
+// see goup.CancelConfirm
+func CancelRemainder(api MarketTrader, order *goup.Order, pair goup.CurrencyPair) (*goup.Order, error) {
+	o, err := api.GetOrder(order.OrderID, pair)
+	if err != nil {
+		return order, err
+	}
+	if o.Status.Done() {
+		return o, nil
+	}
+
+	if o, err = goup.CancelConfirm(api, order.OrderID, pair); o == nil {
+		return order, err
+	}
+	return o, err
+}
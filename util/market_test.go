@@ -0,0 +1,103 @@
+package util
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jflyup/goup"
+)
+
+// taker fills an order at once up to fill, the rest rests until canceled
+type taker struct {
+	depth    *goup.Depth
+	fill     float64
+	placed   *goup.Order
+	canceled bool
+}
+
+func (t *taker) LimitBuy(amount, price float64, pair goup.CurrencyPair) (*goup.Order, error) {
+	t.placed = &goup.Order{OrderID: "1", Side: goup.Buy, Price: price, Amount: amount}
+	return t.placed, nil
+}
+
+func (t *taker) LimitSell(amount, price float64, pair goup.CurrencyPair) (*goup.Order, error) {
+	t.placed = &goup.Order{OrderID: "1", Side: goup.Sell, Price: price, Amount: amount}
+	return t.placed, nil
+}
+
+func (t *taker) CancelOrder(orderID string, pair goup.CurrencyPair) (bool, error) {
+	if t.fill >= t.placed.Amount {
+		return false, errors.New("order not found")
+	}
+	t.canceled = true
+	return true, nil
+}
+
+func (t *taker) GetOrder(orderID string, pair goup.CurrencyPair) (*goup.Order, error) {
+	o := *t.placed
+	o.DealAmount = t.fill
+	o.Status = goup.PartialFilled
+	if o.DealAmount > o.Amount {
+		o.DealAmount = o.Amount
+	}
+	if o.DealAmount == o.Amount {
+		o.Status = goup.Filled
+	} else if t.canceled {
+		o.Status = goup.Canceled
+	}
+	return &o, nil
+}
+
+func (t *taker) GetDepth(pair goup.CurrencyPair, size int) (*goup.Depth, error) {
+	return t.depth, nil
+}
+
+func TestMarketOrder(t *testing.T) {
+	defer func(w time.Duration) { marketWait = w }(marketWait)
+	marketWait = 0
+	depth := &goup.Depth{
+		AskList: goup.DepthRecords{{Price: 100, Amount: 1}, {Price: 102, Amount: 1}, {Price: 110, Amount: 5}},
+		BidList: goup.DepthRecords{{Price: 99, Amount: 1}, {Price: 96, Amount: 2}, {Price: 90, Amount: 5}},
+	}
+
+	tables := []struct {
+		side          goup.TradeSide
+		amount, limit float64
+		fill          float64
+		price, size   float64
+		status        goup.OrderStatus
+	}{
+		// 151 quote buys 1@100 and 0.5@102
+		{goup.Buy, 151, 0, 10, 102, 1.5, goup.Filled},
+		// 110 is beyond slippage, only 2 are taken
+		{goup.Buy, 1000, 0, 1, 102, 2, goup.Canceled},
+		// limit is tighter than slippage
+		{goup.Buy, 1000, 101, 10, 100, 1, goup.Filled},
+		{goup.Sell, 2, 0, 2, 96, 2, goup.Filled},
+		{goup.Sell, 10, 0, 0, 96, 3, goup.Canceled},
+	}
+
+	for _, table := range tables {
+		tr := &taker{depth: depth, fill: table.fill}
+		var o *goup.Order
+		var err error
+		if table.side == goup.Buy {
+			o, err = MarketBuy(tr, table.amount, table.limit, 0.05, goup.CurrencyPair{})
+		} else {
+			o, err = MarketSell(tr, table.amount, table.limit, 0.05, goup.CurrencyPair{})
+		}
+		if err != nil {
+			t.Errorf("%+v: %v", table, err)
+			continue
+		}
+
+		if tr.placed.Price != table.price || tr.placed.Amount != table.size || o.Status != table.status {
+			t.Errorf("%+v: placed %+v, got %+v", table, tr.placed, o)
+		}
+	}
+
+	if _, err := MarketBuy(&taker{depth: &goup.Depth{}}, 1, 0, DefaultMaxSlippage, goup.CurrencyPair{}); err != goup.ErrNoLiquidity {
+		t.Errorf("empty book: got %v", err)
+	}
+}
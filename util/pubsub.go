@@ -1,5 +1,11 @@
 package util
 
+import (
+	"sync/atomic"
+
+	"github.com/jflyup/goup"
+)
+
 type operation int
 
 const (
@@ -24,6 +30,14 @@ type cmd struct {
 	topics []string
 	ch     chan interface{}
 	msg    interface{}
+	sub    *subscriber
+}
+
+// subscriber is the delivery settings of a channel
+type subscriber struct {
+	once    bool
+	policy  goup.Backpressure
+	dropped *uint64
 }
 
 // New creates a new PubSub and starts a goroutine for handling operations.
@@ -46,13 +60,27 @@ func (ps *PubSub) SubOnce(topics ...string) chan interface{} {
 	return ps.sub(subOnce, topics...)
 }
 
+// SubWithPolicy is similar to Sub, but a full channel is handled as policy
+// says instead of blocking the publisher. Each discarded message increases
+// dropped atomically if it's not nil. A Conflate channel holds a single message.
+func (ps *PubSub) SubWithPolicy(policy goup.Backpressure, dropped *uint64, topics ...string) chan interface{} {
+	capacity := ps.capacity
+	if policy == goup.Conflate {
+		capacity = 1
+	}
+
+	ch := make(chan interface{}, capacity)
+	ps.cmdChan <- cmd{op: sub, topics: topics, ch: ch, sub: &subscriber{policy: policy, dropped: dropped}}
+	return ch
+}
+
 func (ps *PubSub) sub(op operation, topics ...string) chan interface{} {
 	ch := make(chan interface{}, ps.capacity)
-	ps.cmdChan <- cmd{op: op, topics: topics, ch: ch}
+	ps.cmdChan <- cmd{op: op, topics: topics, ch: ch, sub: &subscriber{once: op == subOnce}}
 	return ch
 }
 
-// AddSub adds subscriptions to an existing channel.
+// AddSub adds subscriptions to an existing channel, keeping its policy.
 func (ps *PubSub) AddSub(ch chan interface{}, topics ...string) {
 	ps.cmdChan <- cmd{op: sub, topics: topics, ch: ch}
 }
@@ -95,7 +123,7 @@ func (ps *PubSub) Shutdown() {
 
 func (ps *PubSub) start() {
 	reg := registry{
-		topics:    make(map[string]map[chan interface{}]bool),
+		topics:    make(map[string]map[chan interface{}]*subscriber),
 		revTopics: make(map[chan interface{}]map[string]bool),
 	}
 
@@ -115,11 +143,8 @@ loop:
 
 		for _, topic := range cmd.topics {
 			switch cmd.op {
-			case sub:
-				reg.add(topic, cmd.ch, false)
-
-			case subOnce:
-				reg.add(topic, cmd.ch, true)
+			case sub, subOnce:
+				reg.add(topic, cmd.ch, cmd.sub)
 
 			case tryPub:
 				reg.sendNoWait(topic, cmd.msg)
@@ -146,15 +171,25 @@ loop:
 // registry maintains the current subscription state. It's not
 // safe to access a registry from multiple goroutines simultaneously.
 type registry struct {
-	topics    map[string]map[chan interface{}]bool
+	topics    map[string]map[chan interface{}]*subscriber
 	revTopics map[chan interface{}]map[string]bool
 }
 
-func (reg *registry) add(topic string, ch chan interface{}, once bool) {
+func (reg *registry) add(topic string, ch chan interface{}, s *subscriber) {
+	if s == nil {
+		// the channel keeps the policy it was subscribed with
+		s = &subscriber{}
+		for t := range reg.revTopics[ch] {
+			s.policy = reg.topics[t][ch].policy
+			s.dropped = reg.topics[t][ch].dropped
+			break
+		}
+	}
+
 	if reg.topics[topic] == nil {
-		reg.topics[topic] = make(map[chan interface{}]bool)
+		reg.topics[topic] = make(map[chan interface{}]*subscriber)
 	}
-	reg.topics[topic][ch] = once
+	reg.topics[topic][ch] = s
 
 	if reg.revTopics[ch] == nil {
 		reg.revTopics[ch] = make(map[string]bool)
@@ -163,9 +198,8 @@ func (reg *registry) add(topic string, ch chan interface{}, once bool) {
 }
 
 func (reg *registry) send(topic string, msg interface{}) {
-	for ch, once := range reg.topics[topic] {
-		ch <- msg
-		if once {
+	for ch, s := range reg.topics[topic] {
+		if s.deliver(ch, msg) && s.once {
 			for topic := range reg.revTopics[ch] {
 				reg.remove(topic, ch)
 			}
@@ -174,10 +208,10 @@ func (reg *registry) send(topic string, msg interface{}) {
 }
 
 func (reg *registry) sendNoWait(topic string, msg interface{}) {
-	for ch, once := range reg.topics[topic] {
+	for ch, s := range reg.topics[topic] {
 		select {
 		case ch <- msg:
-			if once {
+			if s.once {
 				for topic := range reg.revTopics[ch] {
 					reg.remove(topic, ch)
 				}
@@ -188,6 +222,47 @@ func (reg *registry) sendNoWait(topic string, msg interface{}) {
 	}
 }
 
+// deliver sends msg to ch according to the policy, it reports whether msg
+// was delivered. Only the registry goroutine sends on ch, so a receive always
+// makes room for the next send.
+func (s *subscriber) deliver(ch chan interface{}, msg interface{}) bool {
+	switch s.policy {
+	case goup.DropNewest:
+		select {
+		case ch <- msg:
+			return true
+		default:
+			s.drop()
+			return false
+		}
+
+	case goup.DropOldest, goup.Conflate:
+		for {
+			select {
+			case ch <- msg:
+				return true
+			default:
+			}
+
+			select {
+			case <-ch:
+				s.drop()
+			default:
+			}
+		}
+
+	default:
+		ch <- msg
+		return true
+	}
+}
+
+func (s *subscriber) drop() {
+	if s.dropped != nil {
+		atomic.AddUint64(s.dropped, 1)
+	}
+}
+
 func (reg *registry) removeTopic(topic string) {
 	for ch := range reg.topics[topic] {
 		reg.remove(topic, ch)
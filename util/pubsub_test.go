@@ -1,5 +1,12 @@
 package util
 
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/jflyup/goup"
+)
+
 // import (
 // 	"runtime"
 // 	"testing"
@@ -242,3 +249,47 @@ package util
 
 // 	ps.Shutdown()
 // }
+
+func TestSubWithPolicy(t *testing.T) {
+	tables := []struct {
+		policy  goup.Backpressure
+		want    []int
+		dropped uint64
+	}{
+		{goup.DropNewest, []int{0, 1}, 3},
+		{goup.DropOldest, []int{3, 4}, 3},
+		{goup.Conflate, []int{4}, 4},
+	}
+
+	for _, table := range tables {
+		ps := NewPubSub(2)
+		var dropped uint64
+		ch := ps.SubWithPolicy(table.policy, &dropped, "t1")
+
+		// nobody reads the channel, Pub must not block
+		for i := 0; i < 5; i++ {
+			ps.Pub(i, "t1")
+		}
+		ps.Shutdown()
+
+		var got []int
+		for msg := range ch {
+			got = append(got, msg.(int))
+		}
+
+		if len(got) != len(table.want) {
+			t.Errorf("%s: got %v, want %v", table.policy, got, table.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != table.want[i] {
+				t.Errorf("%s: got %v, want %v", table.policy, got, table.want)
+				break
+			}
+		}
+
+		if n := atomic.LoadUint64(&dropped); n != table.dropped {
+			t.Errorf("%s: dropped %d, want %d", table.policy, n, table.dropped)
+		}
+	}
+}
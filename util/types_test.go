@@ -2,6 +2,8 @@ package util
 
 import (
 	"testing"
+
+	"github.com/jflyup/goup"
 )
 
 func TestTruncate(t *testing.T) {
@@ -41,3 +43,22 @@ func TestTruncate(t *testing.T) {
 // 		DepthRecord{Price: 0.000323, Amount: 10809.7363},
 // 	}
 // }
+
+func TestCalcPrice(t *testing.T) {
+	asks := goup.DepthRecords{{Price: 2, Amount: 1}, {Price: 4, Amount: 1}}
+	if price, err := CalcBuyPrice(asks, 6); err != nil || price != 3 {
+		t.Errorf("CalcBuyPrice = %f, %v, want 3", price, err)
+	}
+
+	if _, err := CalcBuyPrice(asks, 7); err == nil {
+		t.Error("CalcBuyPrice filled more than the book")
+	}
+
+	if price, err := CalcBuyPrice(nil, 1); err == nil || price != 0 {
+		t.Errorf("CalcBuyPrice on empty book = %f, %v", price, err)
+	}
+
+	if price, err := CalcSellPrice(nil, 1); err == nil || price != 0 {
+		t.Errorf("CalcSellPrice on empty book = %f, %v", price, err)
+	}
+}
@@ -2,12 +2,15 @@ package util
 
 import (
 	"errors"
+	"fmt"
 	"log"
 	"math"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/jflyup/goup"
+	"github.com/jflyup/goup/analytics"
 )
 
 // Retry executes a function until:
@@ -36,8 +39,15 @@ type stopError struct {
 
 // ReconnectWs re-establish a websocket connection
 func ReconnectWs(endpoint string) (c *websocket.Conn, err error) {
-	if e := Retry(3, 5*time.Second, func() error {
-		c, _, err = websocket.DefaultDialer.Dial(endpoint, nil)
+	return dialWs(websocket.DefaultDialer, endpoint)
+}
+
+// dialWait is how long dialing waits before the first retry
+var dialWait = 5 * time.Second
+
+func dialWs(dialer *websocket.Dialer, endpoint string) (c *websocket.Conn, err error) {
+	if e := Retry(3, dialWait, func() error {
+		c, _, err = dialer.Dial(endpoint, nil)
 		if err != nil {
 			log.Printf("failed to establish a websocket connection: %v, retrying...", err)
 			return err
@@ -50,51 +60,39 @@ func ReconnectWs(endpoint string) (c *websocket.Conn, err error) {
 	return
 }
 
-// CalcBuyPrice returns the price
-func CalcBuyPrice(asks goup.DepthRecords, amount float64) float64 {
-	cost := amount
-	bought := 0.0
-	for _, ask := range asks {
-		if ask.Price*ask.Amount >= amount {
-			bought += amount / ask.Price
-			amount = 0
-			break
-		} else {
-			amount -= ask.Price * ask.Amount
-			bought += ask.Amount
-		}
+// CalcBuyPrice returns the average price of spending amount of quote currency
+// on asks, an error is returned if the market can't fill it
+func CalcBuyPrice(asks goup.DepthRecords, amount float64) (float64, error) {
+	e := analytics.EstimateBuy(asks, amount, analytics.Quote)
+	if !e.Complete() {
+		return e.AvgPrice, errors.New("the market can't fill this buy order")
 	}
 
-	// if amount > 0 {
-	// 	log.Printf("the market can't fill this sell order, amount: %f", amount)
-	// }
-
-	return cost / bought
+	return e.AvgPrice, nil
 }
 
+// CalcSellPrice returns the average price of selling amount of base currency
+// to bids, an error is returned if the market can't fill it
 func CalcSellPrice(bids goup.DepthRecords, amount float64) (float64, error) {
-	sales := 0.0
-	sold := 0.0
-	for _, bid := range bids {
-		if bid.Amount >= amount {
-			sales += amount * bid.Price
-			sold += amount
-			amount = 0
-			break
-		} else {
-			amount -= bid.Amount
-			sold += bid.Amount
-			sales += bid.Amount * bid.Price
-		}
+	e := analytics.EstimateSell(bids, amount, analytics.Base)
+	if !e.Complete() {
+		return e.AvgPrice, errors.New("the market can't fill this sell order")
 	}
 
-	var err error
-	if amount > 0 {
-		//log.Printf("the market can't fill this sell order, amount: %f", amount)
-		err = errors.New("the market can't fill this sell order")
-	}
+	return e.AvgPrice, nil
+}
+
+// NowMs returns the current time in ms
+func NowMs() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
+
+var idSeq uint64
 
-	return sales / sold, err
+// NewID returns an ID unique within the process and across restarts, the
+// time in ms followed by a sequence number
+func NewID() string {
+	return fmt.Sprintf("%x-%x", NowMs(), atomic.AddUint64(&idSeq, 1))
 }
 
 func Truncate(num float64, precision int) float64 {
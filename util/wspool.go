@@ -0,0 +1,384 @@
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// defaultMaxSubs is the number of subscriptions a connection carries by default
+const defaultMaxSubs = 50
+
+var errPoolClosed = errors.New("websocket pool closed")
+
+// topics which failed to re-subscribe after a connection broke are retried
+// after resubscribeBackoff, doubled on every failure up to the max
+var (
+	resubscribeBackoff    = time.Second
+	maxResubscribeBackoff = time.Minute
+)
+
+// WsPool shards subscriptions across multiple websocket connections to the
+// same endpoint, each connection has its own reader goroutine which passes
+// every message to the handler. Handler may be called from several goroutines
+// simultaneously.
+type WsPool struct {
+	endpoint string
+	handler  func(msg []byte)
+	lock     sync.Mutex
+	maxSubs  int
+	nextID   int
+	conns    []*poolConn
+	closed   bool
+	// compression must be set before dialing
+	compression Compression
+	// tap holds a func(*Frame), it's read without the lock on the hot path
+	tap atomic.Value
+}
+
+type poolConn struct {
+	pool      *WsPool
+	id        int
+	conn      *websocket.Conn
+	writeLock sync.Mutex
+	// subscribe events by topic, kept for re-subscribing when reconnecting
+	subs   map[string]interface{}
+	topics []string
+}
+
+// NewWsPool creates a pool for endpoint, no connection is established until
+// the first subscription.
+func NewWsPool(endpoint string, handler func(msg []byte)) *WsPool {
+	return &WsPool{
+		endpoint: endpoint,
+		handler:  handler,
+		maxSubs:  defaultMaxSubs,
+	}
+}
+
+// SetMaxSubs sets the max number of subscriptions per connection,
+// it only affects subscriptions made afterwards.
+func (p *WsPool) SetMaxSubs(n int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if n > 0 {
+		p.maxSubs = n
+	}
+}
+
+// SetCompression tells how the payloads of the endpoint are compressed,
+// it only affects connections dialed afterwards.
+func (p *WsPool) SetCompression(c Compression) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.compression = c
+}
+
+// SetTap installs a hook which sees every raw frame sent or received by the
+// pool, it's useful for debugging and capturing. The hook is called from the
+// reader goroutines, so it must be safe for concurrent use and should not block.
+func (p *WsPool) SetTap(tap func(*Frame)) {
+	p.tap.Store(tap)
+}
+
+// Len returns the number of live connections
+func (p *WsPool) Len() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return len(p.conns)
+}
+
+// Subscribe sends subEvent on the least loaded connection which has room
+// for another topic, a new connection is dialed if all of them are full.
+// Subscribing to a topic twice is a no-op.
+func (p *WsPool) Subscribe(topic string, subEvent interface{}) error {
+	for {
+		p.lock.Lock()
+		if p.closed {
+			p.lock.Unlock()
+			return errPoolClosed
+		}
+
+		var pc *poolConn
+		for _, c := range p.conns {
+			if _, ok := c.subs[topic]; ok {
+				p.lock.Unlock()
+				return nil
+			}
+
+			if len(c.topics) < p.maxSubs && (pc == nil || len(c.topics) < len(pc.topics)) {
+				pc = c
+			}
+		}
+
+		if pc != nil {
+			// the topic is taken before writing so it's subscribed once
+			pc.subs[topic] = subEvent
+			pc.topics = append(pc.topics, topic)
+			p.lock.Unlock()
+
+			if err := pc.writeJSON(subEvent); err != nil {
+				log.Printf("ERROR	websocket write error: %v", err)
+				p.lock.Lock()
+				pc.remove(topic)
+				p.lock.Unlock()
+				return err
+			}
+			return nil
+		}
+		p.lock.Unlock()
+
+		// the new connection has room unless others took it meanwhile
+		if _, err := p.dial(); err != nil {
+			return err
+		}
+	}
+}
+
+// Resubscribe sends the subscribe event of topic again on its connection,
+// e.g. to get a fresh snapshot after the local state went out of sync.
+func (p *WsPool) Resubscribe(topic string) error {
+	p.lock.Lock()
+	if p.closed {
+		p.lock.Unlock()
+		return errPoolClosed
+	}
+
+	for _, c := range p.conns {
+		if subEvent, ok := c.subs[topic]; ok {
+			p.lock.Unlock()
+			return c.writeJSON(subEvent)
+		}
+	}
+	p.lock.Unlock()
+
+	return errors.New("not subscribed to " + topic)
+}
+
+// Send writes v to the connection carrying topic, or to any connection if
+// topic is empty or unknown. Unlike Subscribe, v is not replayed on reconnect.
+func (p *WsPool) Send(topic string, v interface{}) error {
+	p.lock.Lock()
+	if p.closed {
+		p.lock.Unlock()
+		return errPoolClosed
+	}
+
+	var pc *poolConn
+	for _, c := range p.conns {
+		if _, ok := c.subs[topic]; ok {
+			pc = c
+			break
+		}
+	}
+
+	if pc == nil && len(p.conns) > 0 {
+		pc = p.conns[0]
+	}
+	p.lock.Unlock()
+
+	if pc == nil {
+		var err error
+		if pc, err = p.dial(); err != nil {
+			return err
+		}
+	}
+
+	return pc.writeJSON(v)
+}
+
+// Replay feeds the inbound frames captured by a FrameRecorder to the handler
+// of the pool as if they were read from the network, outbound frames are skipped.
+func (p *WsPool) Replay(r io.Reader) error {
+	p.lock.Lock()
+	dec := newDecoder(p.compression)
+	p.lock.Unlock()
+
+	return ReadFrames(r, func(f *Frame) {
+		if f.Direction != Inbound {
+			return
+		}
+
+		messageType := websocket.TextMessage
+		if f.Binary {
+			messageType = websocket.BinaryMessage
+		}
+
+		if msg, err := dec.decode(messageType, f.Data); err != nil {
+			log.Printf("ERROR\t%v", err)
+		} else {
+			p.handler(msg)
+		}
+	})
+}
+
+// Close closes all connections, the pool can't be used anymore.
+func (p *WsPool) Close() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.closed = true
+	for _, c := range p.conns {
+		c.conn.Close()
+	}
+	p.conns = nil
+}
+
+// dial establishes a new connection, adds it to the pool and starts reading
+// it. It must be called without holding the lock, dialing may take long.
+func (p *WsPool) dial() (*poolConn, error) {
+	p.lock.Lock()
+	compression := p.compression
+	p.lock.Unlock()
+
+	dialer := *websocket.DefaultDialer
+	dialer.EnableCompression = compression == PerMessageDeflate
+	conn, err := dialWs(&dialer, p.endpoint)
+	if err != nil {
+		log.Printf("ERROR\tfailed to dial %s: %v", p.endpoint, err)
+		return nil, err
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	// the pool may have been closed while dialing
+	if p.closed {
+		conn.Close()
+		return nil, errPoolClosed
+	}
+
+	p.nextID++
+	pc := &poolConn{
+		pool: p,
+		id:   p.nextID,
+		conn: conn,
+		subs: make(map[string]interface{}),
+	}
+	p.conns = append(p.conns, pc)
+
+	go p.readLoop(pc, newDecoder(compression))
+	return pc, nil
+}
+
+func (p *WsPool) readLoop(pc *poolConn, dec *decoder) {
+	for {
+		messageType, data, err := pc.conn.ReadMessage()
+		if err != nil {
+			p.rebalance(pc, err)
+			return
+		}
+
+		p.emit(Inbound, pc.id, messageType == websocket.BinaryMessage, data)
+		msg, err := dec.decode(messageType, data)
+		if err != nil {
+			log.Printf("ERROR\t%v", err)
+			continue
+		}
+
+		p.handler(msg)
+	}
+}
+
+// rebalance drops a broken connection and spreads its topics over the
+// remaining connections, dialing new ones when needed. Topics which fail to
+// re-subscribe are retried with backoff until the pool is closed.
+func (p *WsPool) rebalance(pc *poolConn, err error) {
+	p.lock.Lock()
+	if p.closed {
+		p.lock.Unlock()
+		return
+	}
+
+	log.Printf("ERROR\tfailed to read from websocket %s#%d: %v", p.endpoint, pc.id, err)
+
+	for i, c := range p.conns {
+		if c == pc {
+			p.conns = append(p.conns[:i], p.conns[i+1:]...)
+			break
+		}
+	}
+	topics := append([]string(nil), pc.topics...)
+	subs := make(map[string]interface{}, len(pc.subs))
+	for topic, subEvent := range pc.subs {
+		subs[topic] = subEvent
+	}
+	p.lock.Unlock()
+
+	pc.conn.Close()
+	for backoff := resubscribeBackoff; ; backoff *= 2 {
+		var failed []string
+		for _, topic := range topics {
+			err := p.Subscribe(topic, subs[topic])
+			if err == errPoolClosed {
+				return
+			}
+
+			if err != nil {
+				log.Printf("ERROR\tfailed to re-subscribe %s: %v", topic, err)
+				failed = append(failed, topic)
+			}
+		}
+
+		if len(failed) == 0 {
+			return
+		}
+
+		if backoff > maxResubscribeBackoff {
+			backoff = maxResubscribeBackoff
+		}
+		time.Sleep(backoff)
+		topics = failed
+	}
+}
+
+func (p *WsPool) emit(dir FrameDirection, connID int, binary bool, data []byte) {
+	if tap, _ := p.tap.Load().(func(*Frame)); tap != nil {
+		tap(&Frame{
+			Direction: dir,
+			Time:      time.Now(),
+			ConnID:    connID,
+			Binary:    binary,
+			Data:      data,
+		})
+	}
+}
+
+// remove drops topic, the caller must hold the lock of the pool
+func (pc *poolConn) remove(topic string) {
+	delete(pc.subs, topic)
+	for i, t := range pc.topics {
+		if t == topic {
+			pc.topics = append(pc.topics[:i], pc.topics[i+1:]...)
+			break
+		}
+	}
+}
+
+func (pc *poolConn) writeJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	// Applications are responsible for ensuring that
+	// no more than one goroutine calls the write methods concurrently
+	// and that no more than one goroutine calls the read methods concurrently.
+	pc.writeLock.Lock()
+	err = pc.conn.WriteMessage(websocket.TextMessage, data)
+	pc.writeLock.Unlock()
+
+	if err == nil {
+		pc.pool.emit(Outbound, pc.id, false, data)
+	}
+	return err
+}
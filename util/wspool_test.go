@@ -0,0 +1,231 @@
+package util
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// echoServer replies every message it receives, connections are kept so
+// that tests can drop them.
+type echoServer struct {
+	*httptest.Server
+	lock  sync.Mutex
+	conns []*websocket.Conn
+	// down refuses new connections
+	down bool
+}
+
+func newEchoServer() *echoServer {
+	s := &echoServer{}
+	upgrader := websocket.Upgrader{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.lock.Lock()
+		down := s.down
+		s.lock.Unlock()
+		if down {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+
+		s.lock.Lock()
+		s.conns = append(s.conns, conn)
+		s.lock.Unlock()
+
+		for {
+			mt, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteMessage(mt, msg)
+		}
+	}))
+
+	return s
+}
+
+func (s *echoServer) endpoint() string {
+	return "ws" + strings.TrimPrefix(s.URL, "http")
+}
+
+func TestWsPoolSharding(t *testing.T) {
+	s := newEchoServer()
+	defer s.Close()
+
+	received := make(chan string, 16)
+	p := NewWsPool(s.endpoint(), func(msg []byte) {
+		received <- strings.Trim(string(msg), "\"\n")
+	})
+	defer p.Close()
+	p.SetMaxSubs(2)
+
+	topics := []string{"a", "b", "c", "d", "e"}
+	for _, topic := range topics {
+		if err := p.Subscribe(topic, topic); err != nil {
+			t.Fatalf("subscribe %s: %v", topic, err)
+		}
+	}
+
+	// subscribing twice is a no-op
+	if err := p.Subscribe("a", "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Len() != 3 {
+		t.Errorf("got %d connections, want 3", p.Len())
+	}
+
+	for range topics {
+		select {
+		case <-received:
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for echo")
+		}
+	}
+}
+
+func TestWsPoolRebalance(t *testing.T) {
+	s := newEchoServer()
+	defer s.Close()
+
+	received := make(chan string, 16)
+	p := NewWsPool(s.endpoint(), func(msg []byte) {
+		received <- strings.Trim(string(msg), "\"\n")
+	})
+	defer p.Close()
+	p.SetMaxSubs(2)
+
+	for _, topic := range []string{"a", "b", "c"} {
+		if err := p.Subscribe(topic, topic); err != nil {
+			t.Fatal(err)
+		}
+		<-received
+	}
+
+	// drop the first connection, its topics must be re-subscribed elsewhere
+	s.lock.Lock()
+	s.conns[0].Close()
+	s.lock.Unlock()
+
+	got := map[string]bool{}
+	for len(got) < 2 {
+		select {
+		case msg := <-received:
+			got[msg] = true
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting for re-subscription, got %v", got)
+		}
+	}
+
+	if !got["a"] || !got["b"] {
+		t.Errorf("unexpected re-subscriptions: %v", got)
+	}
+}
+
+func TestWsPoolResubscribeRetry(t *testing.T) {
+	defer func(backoff, wait time.Duration) {
+		resubscribeBackoff, dialWait = backoff, wait
+	}(resubscribeBackoff, dialWait)
+	resubscribeBackoff, dialWait = 10*time.Millisecond, time.Millisecond
+
+	s := newEchoServer()
+	defer s.Close()
+
+	received := make(chan string, 16)
+	p := NewWsPool(s.endpoint(), func(msg []byte) {
+		received <- strings.Trim(string(msg), "\"\n")
+	})
+	defer p.Close()
+
+	if err := p.Subscribe("a", "a"); err != nil {
+		t.Fatal(err)
+	}
+	<-received
+
+	// the connection drops while the server is down, the topic is kept
+	s.lock.Lock()
+	s.down = true
+	s.conns[0].Close()
+	s.lock.Unlock()
+
+	time.Sleep(50 * time.Millisecond)
+	if p.Len() != 0 {
+		t.Fatalf("got %d connections while down", p.Len())
+	}
+
+	s.lock.Lock()
+	s.down = false
+	s.lock.Unlock()
+
+	select {
+	case msg := <-received:
+		if msg != "a" {
+			t.Errorf("re-subscribed %q, want %q", msg, "a")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("topic not re-subscribed once the server is back")
+	}
+
+	p.Close()
+	if err := p.Resubscribe("a"); err != errPoolClosed {
+		t.Errorf("got %v, want errPoolClosed", err)
+	}
+}
+
+func TestWsPoolTap(t *testing.T) {
+	s := newEchoServer()
+	defer s.Close()
+
+	received := make(chan string, 16)
+	p := NewWsPool(s.endpoint(), func(msg []byte) {
+		received <- strings.Trim(string(msg), "\"\n")
+	})
+	defer p.Close()
+
+	var buf bytes.Buffer
+	rec := NewFrameRecorder(&buf)
+	p.SetTap(rec.Record)
+
+	if err := p.Subscribe("a", "a"); err != nil {
+		t.Fatal(err)
+	}
+	<-received
+
+	var frames []*Frame
+	rec.lock.Lock()
+	err := ReadFrames(bytes.NewReader(buf.Bytes()), func(f *Frame) {
+		frames = append(frames, f)
+	})
+	rec.lock.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(frames) != 2 || frames[0].Direction != Outbound || frames[1].Direction != Inbound {
+		t.Fatalf("unexpected frames: %+v", frames)
+	}
+
+	if frames[1].ConnID != 1 || string(frames[1].Data) != string(frames[0].Data) {
+		t.Errorf("unexpected inbound frame: %+v", frames[1])
+	}
+
+	// replaying the capture feeds the inbound frame to the handler again
+	if err := p.Replay(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+
+	if msg := <-received; msg != "a" {
+		t.Errorf("replayed %q, want %q", msg, "a")
+	}
+}